@@ -18,13 +18,14 @@
 package account
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
 
 	"github.com/pagefaultgames/rogueserver/db"
 )
 
-func ChangePW(uuid []byte, password string) error {
+func ChangePW(ctx context.Context, uuid []byte, password string) error {
 	if len(password) < 6 {
 		return fmt.Errorf("invalid password")
 	}
@@ -35,9 +36,9 @@ func ChangePW(uuid []byte, password string) error {
 		return fmt.Errorf(fmt.Sprintf("failed to generate salt: %s", err))
 	}
 
-	err = db.UpdateAccountPassword(uuid, deriveArgon2IDKey([]byte(password), salt), salt)
+	err = db.UpdateAccountPassword(ctx, uuid, deriveArgon2IDKey([]byte(password), salt), salt)
 	if err != nil {
-		return fmt.Errorf("failed to add account record: %s", err)
+		return fmt.Errorf("failed to add account record: %w", err)
 	}
 
 	return nil
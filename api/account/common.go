@@ -20,14 +20,25 @@ package account
 import (
 	"regexp"
 	"runtime"
+	"time"
 
+	"github.com/pagefaultgames/rogueserver/metrics"
 	"golang.org/x/crypto/argon2"
 )
 
+type GenericAuthRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
 type GenericAuthResponse struct {
 	Token string `json:"token"`
 }
 
+type ChangePWRequest struct {
+	Password string `json:"password"`
+}
+
 const (
 	ArgonTime     = 1
 	ArgonMemory   = 256 * 1024
@@ -47,7 +58,9 @@ var (
 )
 
 func deriveArgon2IDKey(password, salt []byte) []byte {
+	start := time.Now()
 	semaphore <- true
+	metrics.ArgonWait.Observe(time.Since(start).Seconds())
 	defer func() { <-semaphore }()
 
 	return argon2.IDKey(password, salt, ArgonTime, ArgonMemory, ArgonThreads, ArgonKeySize)
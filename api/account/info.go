@@ -18,6 +18,8 @@
 package account
 
 import (
+	"context"
+
 	"github.com/pagefaultgames/rogueserver/db"
 	"github.com/pagefaultgames/rogueserver/defs"
 )
@@ -28,12 +30,12 @@ type InfoResponse struct {
 }
 
 // /account/info - get account info
-func Info(username string, uuid []byte) (InfoResponse, error) {
+func Info(ctx context.Context, username string, uuid []byte) (InfoResponse, error) {
 	response := InfoResponse{Username: username, LastSessionSlot: -1}
 
 	highest := -1
 	for i := 0; i < defs.SessionSlotCount; i++ {
-		data, err := db.ReadSessionSaveData(uuid, i)
+		data, err := db.ReadSessionSaveData(ctx, uuid, i)
 		if err != nil {
 			continue
 		}
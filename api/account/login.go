@@ -19,6 +19,7 @@ package account
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"encoding/base64"
@@ -30,7 +31,7 @@ import (
 type LoginResponse GenericAuthResponse
 
 // /account/login - log into account
-func Login(username, password string) (LoginResponse, error) {
+func Login(ctx context.Context, username, password string) (LoginResponse, error) {
 	var response LoginResponse
 
 	if !isValidUsername(username) {
@@ -41,7 +42,7 @@ func Login(username, password string) (LoginResponse, error) {
 		return response, fmt.Errorf("invalid password")
 	}
 
-	key, salt, err := db.FetchAccountKeySaltFromUsername(username)
+	key, salt, err := db.FetchAccountKeySaltFromUsername(ctx, username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return response, fmt.Errorf("account doesn't exist")
@@ -60,7 +61,7 @@ func Login(username, password string) (LoginResponse, error) {
 		return response, fmt.Errorf("failed to generate token: %s", err)
 	}
 
-	err = db.AddAccountSession(username, token)
+	err = db.AddAccountSession(ctx, username, token)
 	if err != nil {
 		return response, fmt.Errorf("failed to add account session")
 	}
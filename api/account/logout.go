@@ -18,6 +18,7 @@
 package account
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -25,8 +26,8 @@ import (
 )
 
 // /account/logout - log out of account
-func Logout(token []byte) error {
-	err := db.RemoveSessionFromToken(token)
+func Logout(ctx context.Context, token []byte) error {
+	err := db.RemoveSessionFromToken(ctx, token)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return fmt.Errorf("token not found")
@@ -18,13 +18,15 @@
 package account
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
+
 	"github.com/pagefaultgames/rogueserver/db"
 )
 
 // /account/register - register account
-func Register(username, password string) error {
+func Register(ctx context.Context, username, password string) error {
 	if !isValidUsername(username) {
 		return fmt.Errorf("invalid username")
 	}
@@ -45,9 +47,9 @@ func Register(username, password string) error {
 		return fmt.Errorf(fmt.Sprintf("failed to generate salt: %s", err))
 	}
 
-	err = db.AddAccountRecord(uuid, username, deriveArgon2IDKey([]byte(password), salt), salt)
+	err = db.AddAccountRecord(ctx, uuid, username, deriveArgon2IDKey([]byte(password), salt), salt)
 	if err != nil {
-		return fmt.Errorf("failed to add account record: %s", err)
+		return fmt.Errorf("failed to add account record: %w", err)
 	}
 
 	return nil
@@ -18,41 +18,76 @@
 package api
 
 import (
+	"context"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pagefaultgames/rogueserver/api/account"
 	"github.com/pagefaultgames/rogueserver/api/daily"
+	"github.com/pagefaultgames/rogueserver/api/event"
+	"github.com/pagefaultgames/rogueserver/api/savedata"
 	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/gameversion"
+	"github.com/pagefaultgames/rogueserver/leaderboard"
+	"github.com/pagefaultgames/rogueserver/logging"
+	"github.com/pagefaultgames/rogueserver/metrics"
+	"github.com/pagefaultgames/rogueserver/ratelimit"
+	"github.com/pagefaultgames/rogueserver/tracing"
 )
 
-func Init(mux *http.ServeMux) {
+func Init(mux *http.ServeMux) error {
 	scheduleStatRefresh()
-	daily.Init()
 
-	// account
-	mux.HandleFunc("GET /account/info", handleAccountInfo)
-	mux.HandleFunc("POST /account/register", handleAccountRegister)
-	mux.HandleFunc("POST /account/login", handleAccountLogin)
-	mux.HandleFunc("POST /account/changepw", handleAccountChangePW)
-	mux.HandleFunc("GET /account/logout", handleAccountLogout)
+	err := daily.Init()
+	if err != nil {
+		return fmt.Errorf("failed to initialize daily seeds: %s", err)
+	}
 
-	// game
-	mux.HandleFunc("GET /game/titlestats", handleGameTitleStats)
-	mux.HandleFunc("GET /game/classicsessioncount", handleGameClassicSessionCount)
+	err = event.Init()
+	if err != nil {
+		return fmt.Errorf("failed to initialize events: %s", err)
+	}
 
-	// savedata
-	mux.HandleFunc("GET /savedata/get", handleSaveData)
-	mux.HandleFunc("POST /savedata/update", handleSaveData)
-	mux.HandleFunc("GET /savedata/delete", handleSaveData)
-	mux.HandleFunc("POST /savedata/clear", handleSaveData)
+	registerRoutes(mux)
 
-	// daily
-	mux.HandleFunc("GET /daily/seed", handleDailySeed)
-	mux.HandleFunc("GET /daily/rankings", handleDailyRankings)
-	mux.HandleFunc("GET /daily/rankingpagecount", handleDailyRankingPageCount)
+	return nil
+}
+
+// registerRoutes registers every route of the routes table on mux and builds the OpenAPI document describing them
+func registerRoutes(mux *http.ServeMux) {
+	for _, route := range routes {
+		var handler http.Handler = route.handler
+		if !route.anyVersion {
+			handler = gameversion.Handler(handler)
+		}
+
+		if !route.unlimited {
+			handler = ratelimit.Handler(route.pattern, accountFromRequest, handler)
+		}
+
+		handler = cacheAccount(handler)
+
+		handler = logging.Handler(route.pattern, metrics.Instrument(route.pattern, handler))
+		mux.Handle(route.pattern, tracing.Instrument(route.pattern, handler))
+	}
+
+	openAPIDocument = buildOpenAPIDocument(routes)
+}
+
+// Stop stops the stat refresh, daily and event schedulers, waiting for running jobs to finish
+func Stop() {
+	<-scheduler.Stop().Done()
+	daily.Stop()
+	event.Stop()
 }
 
 func tokenFromRequest(r *http.Request) ([]byte, error) {
@@ -72,21 +107,324 @@ func tokenFromRequest(r *http.Request) ([]byte, error) {
 	return token, nil
 }
 
+// accountLookupKey is the context key of the token lookup of a request
+type accountLookupKey struct{}
+
+// accountLookup caches the result of looking up the token of a request, so the rate limiter and the handler look it up once
+type accountLookup struct {
+	done bool
+	uuid []byte
+	err  error
+}
+
+// cacheAccount gives the requests to next a place to cache the lookup of their token in
+func cacheAccount(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accountLookupKey{}, &accountLookup{})))
+	})
+}
+
 func uuidFromRequest(r *http.Request) ([]byte, error) {
+	lookup, ok := r.Context().Value(accountLookupKey{}).(*accountLookup)
+	if !ok {
+		lookup = &accountLookup{}
+	}
+
+	if !lookup.done {
+		lookup.uuid, lookup.err = lookupUUID(r)
+		lookup.done = true
+	}
+
+	return lookup.uuid, lookup.err
+}
+
+func lookupUUID(r *http.Request) ([]byte, error) {
 	token, err := tokenFromRequest(r)
 	if err != nil {
 		return nil, err
 	}
 
-	uuid, err := db.FetchUUIDFromToken(token)
+	uuid, err := db.FetchUUIDFromToken(r.Context(), token)
 	if err != nil {
-		return nil, fmt.Errorf("failed to validate token: %s", err)
+		return nil, fmt.Errorf("failed to validate token: %w", err)
 	}
 
+	logging.SetUUID(r.Context(), uuid)
+
 	return uuid, nil
 }
 
+// moderatorFromRequest returns the uuid of the authenticated account if it's a moderator
+func moderatorFromRequest(r *http.Request) ([]byte, int, error) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	moderator, err := db.IsAccountModerator(r.Context(), uuid)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to check moderator: %w", err)
+	}
+
+	if !moderator {
+		return nil, http.StatusForbidden, fmt.Errorf("not a moderator")
+	}
+
+	return uuid, 0, nil
+}
+
+// accountFromRequest identifies the account making the request for rate limiting, if its token is valid.
+// The lookup is cached for the handler, tokens that don't resolve to an account only count against the client's address.
+func accountFromRequest(r *http.Request) string {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(uuid)
+}
 func httpError(w http.ResponseWriter, r *http.Request, err error, code int) {
-	log.Printf("%s: %s\n", r.URL.Path, err)
+	// a stalled database is a temporary condition, not a server error
+	if errors.Is(err, context.DeadlineExceeded) {
+		code = http.StatusServiceUnavailable
+	}
+
+	// saves that break validation rules are the client's fault
+	var validationErr *savedata.ValidationError
+	if errors.As(err, &validationErr) {
+		code = http.StatusBadRequest
+	}
+
+	level := slog.LevelWarn
+	if code >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+
+	slog.Log(r.Context(), level, "request failed", "path", r.URL.Path, "status", code, "error", err)
+
+	// saves from unsupported clients get the same structured response as requests from them
+	var versionErr *gameversion.Error
+	if errors.As(err, &versionErr) {
+		gameversion.WriteError(w, versionErr)
+		return
+	}
+
 	http.Error(w, err.Error(), code)
-}
\ No newline at end of file
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, response any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	_, span := tracing.Start(r.Context(), "json encode")
+	err := json.NewEncoder(w).Encode(response)
+	tracing.End(span, err)
+	if err != nil {
+		httpError(w, r, fmt.Errorf("failed to encode response json: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func readJSON(r *http.Request, v any) error {
+	_, span := tracing.Start(r.Context(), "json decode")
+	err := json.NewDecoder(r.Body).Decode(v)
+	tracing.End(span, err)
+	if err != nil {
+		return fmt.Errorf("failed to decode request body: %s", err)
+	}
+
+	return nil
+}
+
+func slotFromPath(r *http.Request) (int, error) {
+	slot, err := strconv.Atoi(r.PathValue("slot"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert slot: %s", err)
+	}
+
+	return slot, nil
+}
+
+func trainerIdsFromQuery(r *http.Request) (trainerId, secretId int, err error) {
+	if !r.URL.Query().Has("trainerId") || !r.URL.Query().Has("secretId") {
+		return 0, 0, nil
+	}
+
+	trainerId, err = strconv.Atoi(r.URL.Query().Get("trainerId"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	secretId, err = strconv.Atoi(r.URL.Query().Get("secretId"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return trainerId, secretId, nil
+}
+
+func isActiveSessionFromRequest(r *http.Request) (bool, error) {
+	token, err := tokenFromRequest(r)
+	if err != nil {
+		return false, err
+	}
+
+	active, err := db.IsActiveSession(r.Context(), token)
+	if err != nil {
+		return false, fmt.Errorf("failed to check active session: %w", err)
+	}
+
+	return active, nil
+}
+
+// validateTrainerIds checks the given ids against the ones stored for the account,
+// storing them instead if the account doesn't have any yet
+func validateTrainerIds(ctx context.Context, uuid []byte, trainerId, secretId int) (bool, error) {
+	storedTrainerId, storedSecretId, err := db.FetchTrainerIds(ctx, uuid)
+	if err != nil {
+		return false, err
+	}
+
+	if storedTrainerId > 0 || storedSecretId > 0 {
+		return trainerId == storedTrainerId && secretId == storedSecretId, nil
+	}
+
+	db.UpdateTrainerIds(ctx, trainerId, secretId, uuid)
+
+	return true, nil
+}
+
+func categoryFromQuery(r *http.Request) (int, error) {
+	if !r.URL.Query().Has("category") {
+		return 0, nil
+	}
+
+	category, err := strconv.Atoi(r.URL.Query().Get("category"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert category: %s", err)
+	}
+
+	if !daily.ValidCategory(category) {
+		return 0, fmt.Errorf("unknown category %d", category)
+	}
+
+	return category, nil
+}
+
+// limitFromQuery returns the limit query parameter, 10 if there is none
+func limitFromQuery(r *http.Request) (int, error) {
+	if !r.URL.Query().Has("limit") {
+		return 10, nil
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert limit: %s", err)
+	}
+
+	if limit < 1 || limit > daily.MaxRankingLimit {
+		return 0, fmt.Errorf("limit must be within 1 and %d", daily.MaxRankingLimit)
+	}
+
+	return limit, nil
+}
+
+// cursorFromQuery returns the cursor query parameter, nil if there is none
+func cursorFromQuery(r *http.Request) (*defs.RankingCursor, error) {
+	if !r.URL.Query().Has("cursor") {
+		return nil, nil
+	}
+
+	cursor, err := defs.ParseRankingCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &cursor, nil
+}
+
+// notModified sets the validators of version on the response and writes a 304 if the request already has that version.
+// The zero Version, for rankings that aren't cached, sets nothing.
+func notModified(w http.ResponseWriter, r *http.Request, version leaderboard.Version) bool {
+	if version.ETag == "" {
+		return false
+	}
+
+	w.Header().Set("ETag", version.ETag)
+	w.Header().Set("Last-Modified", version.Modified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		matched := false
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == version.ETag || tag == "*" {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || version.Modified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+
+	return true
+}
+
+// leaderboardFromQuery returns the leaderboard selected by the challenge, category and date query parameters
+func leaderboardFromQuery(r *http.Request) (daily.Leaderboard, error) {
+	var board daily.Leaderboard
+
+	board.Challenge = challengeFromQuery(r)
+	if _, ok := daily.Challenge(board.Challenge); !ok {
+		return board, fmt.Errorf("unknown challenge %q", board.Challenge)
+	}
+
+	var err error
+	board.Category, err = categoryFromQuery(r)
+	if err != nil {
+		return board, err
+	}
+
+	board.Date, err = dateFromQuery(r)
+	if err != nil {
+		return board, err
+	}
+
+	return board, nil
+}
+
+// challengeFromQuery returns the challenge query parameter, the default challenge if there is none
+func challengeFromQuery(r *http.Request) string {
+	if !r.URL.Query().Has("challenge") {
+		return defs.DefaultDailyChallenge
+	}
+
+	return r.URL.Query().Get("challenge")
+}
+
+// dateFromQuery returns the day of the date query parameter, today if there is none
+func dateFromQuery(r *http.Request) (time.Time, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if !r.URL.Query().Has("date") {
+		return today, nil
+	}
+
+	date, err := time.Parse(time.DateOnly, r.URL.Query().Get("date"))
+	if err != nil {
+		return today, fmt.Errorf("failed to parse date: %s", err)
+	}
+
+	if date.After(today) {
+		return today, fmt.Errorf("date %s is in the future", date.Format(time.DateOnly))
+	}
+
+	return date, nil
+}
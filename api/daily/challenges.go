@@ -0,0 +1,147 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daily
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+	"gopkg.in/yaml.v3"
+)
+
+// Challenges are played every day, each with its own seed and leaderboards. LoadChallenges replaces them.
+var Challenges = []defs.DailyChallenge{
+	{Id: defs.DefaultDailyChallenge, Name: "Daily Run", GameMode: 3, Waves: 50},
+}
+
+var challengeIdPattern = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+// LoadChallenges reads a list of challenges from a YAML or JSON file, which has to include the default challenge
+func LoadChallenges(path string) ([]defs.DailyChallenge, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read daily challenges: %s", err)
+	}
+
+	var challenges []defs.DailyChallenge
+	err = yaml.Unmarshal(data, &challenges)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse daily challenges: %s", err)
+	}
+
+	ids := make(map[string]bool)
+	for _, challenge := range challenges {
+		if !challengeIdPattern.MatchString(challenge.Id) {
+			return nil, fmt.Errorf("invalid daily challenge id %q: must be 1 to 32 lowercase letters, digits or dashes", challenge.Id)
+		}
+
+		if strings.HasPrefix(challenge.Id, defs.EventChallengePrefix) {
+			return nil, fmt.Errorf("invalid daily challenge id %q: %q is reserved for events", challenge.Id, defs.EventChallengePrefix)
+		}
+
+		if ids[challenge.Id] {
+			return nil, fmt.Errorf("duplicate daily challenge id %q", challenge.Id)
+		}
+
+		if challenge.Waves < 1 {
+			return nil, fmt.Errorf("invalid daily challenge %q: waves must be positive", challenge.Id)
+		}
+
+		ids[challenge.Id] = true
+	}
+
+	if !ids[defs.DefaultDailyChallenge] {
+		return nil, fmt.Errorf("daily challenges must include %q", defs.DefaultDailyChallenge)
+	}
+
+	return challenges, nil
+}
+
+// Challenge returns the challenge with id, the default challenge if id is empty
+func Challenge(id string) (defs.DailyChallenge, bool) {
+	if id == "" {
+		id = defs.DefaultDailyChallenge
+	}
+
+	for _, challenge := range Challenges {
+		if challenge.Id == id {
+			return challenge, true
+		}
+	}
+
+	return defs.DailyChallenge{}, false
+}
+
+// DefaultChallenge returns the challenge of requests that don't name one
+func DefaultChallenge() defs.DailyChallenge {
+	challenge, _ := Challenge(defs.DefaultDailyChallenge)
+	return challenge
+}
+
+// IsChallengeMode reports whether any challenge is played in mode
+func IsChallengeMode(mode int) bool {
+	for _, challenge := range Challenges {
+		if challenge.GameMode == mode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ChallengeSeed returns today's recorded seed of challenge, sql.ErrNoRows if there is none
+func ChallengeSeed(ctx context.Context, challenge string) (string, error) {
+	seeds, err := db.FetchDailyChallengeSeeds(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	seed, ok := seeds[challenge]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+
+	return seed, nil
+}
+
+// TodaysChallenge returns the challenge that seed is today's seed of, nil if it isn't one
+func TodaysChallenge(ctx context.Context, seed string) (*defs.DailyChallenge, error) {
+	seeds, err := db.FetchDailyChallengeSeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, challengeSeed := range seeds {
+		if challengeSeed != seed {
+			continue
+		}
+
+		challenge, ok := Challenge(id)
+		if ok {
+			return &challenge, nil
+		}
+	}
+
+	return nil, nil
+}
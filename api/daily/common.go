@@ -18,88 +18,249 @@
 package daily
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
 	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
 	"github.com/robfig/cron/v3"
 )
 
 const secondsPerDay = 60 * 60 * 24
 
+type SeedResponse struct {
+	Seed      string              `json:"seed"`
+	Challenge defs.DailyChallenge `json:"challenge"`
+}
+
+type RankingPageCountResponse struct {
+	PageCount int `json:"pageCount"`
+
+	// Count is the number of rankings
+	Count int `json:"count"`
+}
+
 var (
 	scheduler = cron.New(cron.WithLocation(time.UTC))
-	secret    []byte
+
+	// Secret is the configured secret daily seeds are derived from, stored as a new version whenever it changes, the latest stored version is used if nil
+	Secret []byte
+
+	// SecretRotation is how often a new random secret is stored if none is configured, 0 never rotates it
+	SecretRotation time.Duration
 )
 
-func Init() error {
-	var err error
+/*
+	Daily seeds are derived from the day and a secret, which is versioned in the database so that every instance derives
+	the same seeds. The seed of a day is committed to the day before by publishing the SHA-256 hash of the seed, and
+	revealed once the day starts, so players can verify that it wasn't picked afterwards. A new version of the secret
+	only changes the seeds of days that weren't committed to yet.
+*/
 
-	secret, err = os.ReadFile("secret.key")
+func Init() error {
+	err := initSecret(context.Background())
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return fmt.Errorf("failed to read daily seed secret: %s", err)
-		}
+		return err
+	}
 
-		newSecret := make([]byte, 32)
-		_, err := rand.Read(newSecret)
+	recordNewDaily()
+
+	_, err = scheduler.AddFunc("@daily", func() {
+		time.Sleep(time.Second)
+
+		rotateSecret(context.Background())
+		recordNewDaily()
+
+		err := db.DeleteStaleDailyRunProgress(context.Background())
 		if err != nil {
-			return fmt.Errorf("failed to generate daily seed secret: %s", err)
+			slog.Error("failed to delete stale daily run progress", "error", err)
 		}
+	})
 
-		err = os.WriteFile("secret.key", newSecret, 0400)
+	if err != nil {
+		return err
+	}
+
+	scheduler.Start()
+
+	return nil
+}
+
+// Stop stops the daily seed scheduler, waiting for a running job to finish
+func Stop() {
+	<-scheduler.Stop().Done()
+}
+
+// initSecret stores the configured secret as a new version if it isn't the latest one. Without a configured secret, the first version
+// is the secret.key file in the working directory seeds were derived from before secrets were versioned, or a random secret.
+func initSecret(ctx context.Context) error {
+	_, latest, _, err := db.FetchLatestDailySecret(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read daily seed secret: %s", err)
+	}
+
+	secret := Secret
+	if secret == nil {
+		if latest != nil {
+			return nil
+		}
+
+		secret, err = os.ReadFile("secret.key")
 		if err != nil {
-			return fmt.Errorf("failed to write daily seed secret: %s", err)
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("failed to read daily seed secret: %s", err)
+			}
+
+			secret, err = newSecret()
+			if err != nil {
+				return err
+			}
 		}
+	}
 
-		secret = newSecret
+	if bytes.Equal(secret, latest) {
+		return nil
 	}
 
-	seed, err := recordNewDaily()
+	added, err := db.AddDailySecret(ctx, secret, time.Now())
 	if err != nil {
-		log.Print(err)
+		return fmt.Errorf("failed to store daily seed secret: %s", err)
 	}
 
-	log.Printf("Daily Run Seed: %s", seed)
+	// without a configured secret, the one another instance stored at the same time is as good
+	if added || Secret == nil {
+		return nil
+	}
 
-	_, err = scheduler.AddFunc("@daily", func() {
-		time.Sleep(time.Second)
+	// another instance stored a version at the same time, which is fine if it is the same secret
+	_, latest, _, err = db.FetchLatestDailySecret(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read daily seed secret: %s", err)
+	}
 
-		seed, err = recordNewDaily()
-		log.Printf("Daily Run Seed: %s", seed)
-		if err != nil {
-			log.Printf("error while recording new daily: %s", err)
-		}
-	})
+	if !bytes.Equal(secret, latest) {
+		return fmt.Errorf("failed to store daily seed secret: another instance stored a different secret at the same time")
+	}
+
+	return nil
+}
 
+// rotateSecret stores a new random secret if none is configured and the latest version is older than SecretRotation
+func rotateSecret(ctx context.Context) {
+	if Secret != nil || SecretRotation <= 0 {
+		return
+	}
+
+	secret, err := newSecret()
 	if err != nil {
-		return err
+		slog.Error("failed to rotate daily seed secret", "error", err)
+		return
 	}
 
-	scheduler.Start()
+	rotated, err := db.AddDailySecret(ctx, secret, time.Now().Add(-SecretRotation))
+	if err != nil {
+		slog.Error("failed to rotate daily seed secret", "error", err)
+		return
+	}
 
-	return nil
+	if rotated {
+		slog.Info("rotated daily seed secret")
+	}
 }
 
-func Seed() string {
-	return base64.StdEncoding.EncodeToString(deriveSeed(time.Now().UTC()))
+func newSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate daily seed secret: %s", err)
+	}
+
+	return secret, nil
 }
 
-func deriveSeed(seedTime time.Time) []byte {
+// deriveSeed hashes the day and the secret, and the challenge unless it is the default one so that its seeds stay the same
+func deriveSeed(seedTime time.Time, challenge string, secret []byte) string {
 	day := make([]byte, 8)
 	binary.BigEndian.PutUint64(day, uint64(seedTime.Unix()/secondsPerDay))
 
-	hashedSeed := md5.Sum(append(day, secret...))
+	data := append(day, secret...)
+	if challenge != defs.DefaultDailyChallenge {
+		data = append(data, challenge...)
+	}
+
+	hashedSeed := md5.Sum(data)
+
+	return base64.StdEncoding.EncodeToString(hashedSeed[:])
+}
+
+// recordNewDaily records today's seed of every challenge, the default challenge's also as the daily run, and commits to tomorrow's.
+// Today's seed is the one committed to, if there is a commitment, otherwise it is derived from the latest secret.
+func recordNewDaily() {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	tomorrow := now.AddDate(0, 0, 1)
+
+	version, secret, _, err := db.FetchLatestDailySecret(ctx)
+	if err != nil {
+		slog.Error("failed to read daily seed secret", "error", err)
+		return
+	}
+
+	for _, challenge := range Challenges {
+		seed, err := db.FetchDailySeedCommitment(ctx, now.Format(time.DateOnly), challenge.Id)
+		if errors.Is(err, sql.ErrNoRows) {
+			seed, err = deriveSeed(now, challenge.Id, secret), nil
+		}
+		if err != nil {
+			slog.Error("failed to read daily seed commitment", "challenge", challenge.Id, "error", err)
+			continue
+		}
+
+		if challenge.Id == defs.DefaultDailyChallenge {
+			seed, err = db.TryAddDailyRun(ctx, seed)
+			if err != nil {
+				slog.Error("failed to record new daily", "error", err)
+				continue
+			}
+
+			slog.Info("daily run seed", "seed", seed)
+		}
 
-	return hashedSeed[:]
+		seed, err = db.TryAddDailyChallengeSeed(ctx, challenge.Id, seed)
+		if err != nil {
+			slog.Error("failed to record new daily challenge", "challenge", challenge.Id, "error", err)
+			continue
+		}
+
+		slog.Info("daily challenge seed", "challenge", challenge.Id, "seed", seed)
+
+		seed = deriveSeed(tomorrow, challenge.Id, secret)
+		hash := sha256.Sum256([]byte(seed))
+
+		_, err = db.TryAddDailySeedCommitment(ctx, tomorrow.Format(time.DateOnly), challenge.Id, seed, hex.EncodeToString(hash[:]), version)
+		if err != nil {
+			slog.Error("failed to commit to tomorrow's daily seed", "challenge", challenge.Id, "error", err)
+		}
+	}
 }
 
-func recordNewDaily() (string, error) {
-	return db.TryAddDailyRun(Seed())
+// /daily/commitments - fetch commitments to the seeds of challenge, newest first, with the seeds of days that started
+func Commitments(ctx context.Context, challenge string, page int) ([]defs.DailySeedCommitment, error) {
+	if _, ok := Challenge(challenge); !ok {
+		return nil, fmt.Errorf("unknown challenge %q", challenge)
+	}
+
+	return db.FetchDailySeedCommitments(ctx, challenge, page)
 }
@@ -18,18 +18,254 @@
 package daily
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/pagefaultgames/rogueserver/db"
 	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/leaderboard"
 )
 
-// /daily/rankings - fetch daily rankings
-func Rankings(category, page int) ([]defs.DailyRanking, error) {
-	rankings, err := db.FetchRankings(category, page)
+// MaxRankingLimit is the most rankings a request can ask for at once
+var MaxRankingLimit = 100
+
+// SeasonMonths is the length of a season, seasons start in january
+var SeasonMonths = 3
+
+// Categories are the ranking categories, by their id. Ties are broken in favor of the player whose last counted run was recorded first.
+var Categories = []defs.DailyRankingCategory{
+	{Id: 0, Name: "daily", Period: "day", Aggregate: "best"},
+	{Id: 1, Name: "weekly", Period: "week", Aggregate: "sum"},
+	{Id: 2, Name: "monthly", Period: "month", Aggregate: "sum"},
+	{Id: 3, Name: "season", Period: "season", Aggregate: "sum"},
+	{Id: 4, Name: "alltime", Period: "all", Aggregate: "best"},
+	{Id: 5, Name: "alltimeaverage", Period: "all", Aggregate: "average"},
+}
+
+// category returns the ranking category with id
+func category(id int) (defs.DailyRankingCategory, bool) {
+	for _, category := range Categories {
+		if category.Id == id {
+			return category, true
+		}
+	}
+
+	return defs.DailyRankingCategory{}, false
+}
+
+// ValidCategory reports whether id is a known ranking category
+func ValidCategory(id int) bool {
+	_, ok := category(id)
+	return ok
+}
+
+// period returns the first and last dates of the rankings of category that include date.
+// The all-time rankings always end today, so that every date shares one leaderboard.
+func period(category defs.DailyRankingCategory, date time.Time) (string, string) {
+	var from, to time.Time
+	switch category.Period {
+	case "day":
+		from, to = date, date
+	case "week":
+		from = date.AddDate(0, 0, -int(date.Weekday()))
+		to = from.AddDate(0, 0, 6)
+	case "month":
+		from = time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		to = from.AddDate(0, 1, -1)
+	case "season":
+		from = time.Date(date.Year(), date.Month()-time.Month((int(date.Month())-1)%SeasonMonths), 1, 0, 0, 0, 0, time.UTC)
+		to = from.AddDate(0, SeasonMonths, -1)
+	default:
+		return leaderboard.AllTime, time.Now().UTC().Format(time.DateOnly)
+	}
+
+	return from.Format(time.DateOnly), to.Format(time.DateOnly)
+}
+
+// Leaderboard selects the rankings of Category over the runs of Challenge in the period that includes Date
+type Leaderboard struct {
+	Challenge string
+	Category  int
+	Date      time.Time
+}
+
+// key returns the key of the leaderboard, an error if its challenge or category is unknown
+func (l Leaderboard) key() (leaderboard.Key, error) {
+	if _, ok := Challenge(l.Challenge); !ok {
+		return leaderboard.Key{}, fmt.Errorf("unknown challenge %q", l.Challenge)
+	}
+
+	category, ok := category(l.Category)
+	if !ok {
+		return leaderboard.Key{}, fmt.Errorf("unknown category %d", l.Category)
+	}
+
+	return boardKey(l.Challenge, category, l.Date), nil
+}
+
+// boardKey returns the key of the leaderboard of category over the runs of challenge that includes date
+func boardKey(challenge string, category defs.DailyRankingCategory, date time.Time) leaderboard.Key {
+	from, to := period(category, date)
+	return leaderboard.Key{Challenge: challenge, Aggregate: category.Aggregate, From: from, To: to}
+}
+
+// /daily/rankings - fetch up to limit daily rankings after cursor, or of page if cursor is nil
+func Rankings(ctx context.Context, board Leaderboard, page, limit int, cursor *defs.RankingCursor) ([]defs.DailyRanking, leaderboard.Version, error) {
+	key, err := board.key()
+	if err != nil {
+		return nil, leaderboard.Version{}, err
+	}
+
+	return RankingsOf(ctx, key, page, limit, cursor)
+}
+
+// RankingsOf fetches up to limit rankings of the leaderboard under key after cursor, or of page if cursor is nil
+func RankingsOf(ctx context.Context, key leaderboard.Key, page, limit int, cursor *defs.RankingCursor) ([]defs.DailyRanking, leaderboard.Version, error) {
+	var version leaderboard.Version
+	var err error
+
+	if leaderboard.Backend == nil {
+		var rankings []defs.DailyRanking
+		if cursor != nil {
+			rankings, err = db.FetchRankingsAfter(ctx, key.Challenge, key.Aggregate, key.From, key.To, *cursor, limit)
+		} else {
+			rankings, err = db.FetchRankingsFrom(ctx, key.Challenge, key.Aggregate, key.From, key.To, (page-1)*limit+1, limit)
+		}
+		if err != nil {
+			return nil, version, err
+		}
+
+		return rankings, version, nil
+	}
+
+	var rankings []defs.DailyRanking
+	err = leaderboard.View(ctx, key, func(board *leaderboard.Board) {
+		if cursor != nil {
+			rankings = board.After(*cursor, limit)
+		} else {
+			rankings = board.Rankings((page-1)*limit+1, limit)
+		}
+
+		version = board.Version()
+	})
+	if err != nil {
+		return nil, version, err
+	}
+
+	return rankings, version, nil
+}
+
+// /daily/rankings/me - fetch the ranking of uuid with up to neighbours rankings above and below it, sql.ErrNoRows if uuid isn't ranked.
+// Without a leaderboard backend the rank is counted in the database, which reads every ranked run of the period.
+func Position(ctx context.Context, uuid []byte, board Leaderboard, neighbours int) (defs.DailyRankingPosition, leaderboard.Version, error) {
+	var position defs.DailyRankingPosition
+	var version leaderboard.Version
+
+	key, err := board.key()
+	if err != nil {
+		return position, version, err
+	}
+
+	var rankings []defs.DailyRanking
+	if leaderboard.Backend == nil {
+		position.Ranking, err = db.FetchRanking(ctx, uuid, key.Challenge, key.Aggregate, key.From, key.To)
+		if err != nil {
+			return position, version, err
+		}
+
+		first := max(position.Ranking.Rank-neighbours, 1)
+
+		rankings, err = db.FetchRankingsFrom(ctx, key.Challenge, key.Aggregate, key.From, key.To, first, position.Ranking.Rank-first+neighbours+1)
+		if err != nil {
+			return position, version, err
+		}
+	} else {
+		found := false
+		err = leaderboard.View(ctx, key, func(board *leaderboard.Board) {
+			position.Ranking, found = board.Ranking(uuid)
+			if found {
+				first := max(position.Ranking.Rank-neighbours, 1)
+				rankings = board.Rankings(first, position.Ranking.Rank-first+neighbours+1)
+			}
+
+			version = board.Version()
+		})
+		if err != nil {
+			return position, version, err
+		}
+
+		if !found {
+			return position, version, sql.ErrNoRows
+		}
+	}
+
+	position.Above = []defs.DailyRanking{}
+	position.Below = []defs.DailyRanking{}
+	for _, ranking := range rankings {
+		switch {
+		case ranking.Rank < position.Ranking.Rank:
+			position.Above = append(position.Above, ranking)
+		case ranking.Rank > position.Ranking.Rank:
+			position.Below = append(position.Below, ranking)
+		}
+	}
+
+	return position, version, nil
+}
+
+// RecordRun updates the cached leaderboards with today's run of challenge of uuid
+func RecordRun(ctx context.Context, uuid []byte, challenge string) error {
+	if _, ok := Challenge(challenge); !ok || leaderboard.Backend == nil {
+		return nil
+	}
+
+	run, err := db.FetchRankedDailyRun(ctx, uuid, challenge)
 	if err != nil {
-		log.Print("failed to retrieve rankings")
+		return err
+	}
+
+	date, err := time.Parse(time.DateOnly, run.Date)
+	if err != nil {
+		return err
+	}
+
+	return leaderboard.Record(ctx, boardKeys(challenge, date), run)
+}
+
+// RefreshRankings rebuilds the cached leaderboards of challenge that include date, e.g. after a run was hidden or shown
+func RefreshRankings(ctx context.Context, challenge string, date time.Time) error {
+	if leaderboard.Backend == nil {
+		return nil
+	}
+
+	return leaderboard.Refresh(ctx, boardKeys(challenge, date))
+}
+
+// boardKeys returns the keys of the leaderboards of every category over the runs of challenge that include date, none if challenge isn't a daily challenge
+func boardKeys(challenge string, date time.Time) []leaderboard.Key {
+	var keys []leaderboard.Key
+	if _, ok := Challenge(challenge); !ok {
+		return keys
+	}
+
+	for _, category := range Categories {
+		key := boardKey(challenge, category, date)
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// /daily/seeds - fetch past seeds of challenge with their participant counts and winners
+func Seeds(ctx context.Context, challenge string, page int) ([]defs.DailySeed, error) {
+	if _, ok := Challenge(challenge); !ok {
+		return nil, fmt.Errorf("unknown challenge %q", challenge)
 	}
 
-	return rankings, nil
+	return db.FetchDailySeeds(ctx, challenge, page)
 }
@@ -18,17 +18,39 @@
 package daily
 
 import (
-	"log"
+	"context"
+	"math"
 
 	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/leaderboard"
 )
 
-// /daily/rankingpagecount - fetch daily ranking page count
-func RankingPageCount(category int) (int, error) {
-	pageCount, err := db.FetchRankingPageCount(category)
+// /daily/rankingpagecount - fetch the number of daily ranking pages of limit rankings, and of rankings
+func RankingPageCount(ctx context.Context, board Leaderboard, limit int) (RankingPageCountResponse, leaderboard.Version, error) {
+	var response RankingPageCountResponse
+	var version leaderboard.Version
+
+	key, err := board.key()
 	if err != nil {
-		log.Print("failed to retrieve ranking page count")
+		return response, version, err
+	}
+
+	if leaderboard.Backend == nil {
+		response.Count, err = db.FetchRankingCount(ctx, key.Challenge, key.From, key.To)
+		if err != nil {
+			return response, version, err
+		}
+	} else {
+		err = leaderboard.View(ctx, key, func(board *leaderboard.Board) {
+			response.Count = board.Count()
+			version = board.Version()
+		})
+		if err != nil {
+			return response, version, err
+		}
 	}
 
-	return pageCount, nil
+	response.PageCount = int(math.Ceil(float64(response.Count) / float64(limit)))
+
+	return response, version, nil
 }
@@ -18,7 +18,6 @@
 package api
 
 import (
-	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -27,7 +26,6 @@ import (
 
 	"github.com/pagefaultgames/rogueserver/api/account"
 	"github.com/pagefaultgames/rogueserver/api/daily"
-	"github.com/pagefaultgames/rogueserver/api/savedata"
 	"github.com/pagefaultgames/rogueserver/db"
 	"github.com/pagefaultgames/rogueserver/defs"
 )
@@ -47,13 +45,13 @@ func handleAccountInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	username, err := db.FetchUsernameFromUUID(uuid)
+	username, err := db.FetchUsernameFromUUID(r.Context(), uuid)
 	if err != nil {
 		httpError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
-	response, err := account.Info(username, uuid)
+	response, err := account.Info(r.Context(), username, uuid)
 	if err != nil {
 		httpError(w, r, err, http.StatusInternalServerError)
 		return
@@ -75,7 +73,7 @@ func handleAccountRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = account.Register(r.Form.Get("username"), r.Form.Get("password"))
+	err = account.Register(r.Context(), r.Form.Get("username"), r.Form.Get("password"))
 	if err != nil {
 		httpError(w, r, err, http.StatusInternalServerError)
 		return
@@ -91,7 +89,7 @@ func handleAccountLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := account.Login(r.Form.Get("username"), r.Form.Get("password"))
+	response, err := account.Login(r.Context(), r.Form.Get("username"), r.Form.Get("password"))
 	if err != nil {
 		httpError(w, r, err, http.StatusInternalServerError)
 		return
@@ -119,7 +117,7 @@ func handleAccountChangePW(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = account.ChangePW(uuid, r.Form.Get("password"))
+	err = account.ChangePW(r.Context(), uuid, r.Form.Get("password"))
 	if err != nil {
 		httpError(w, r, err, http.StatusInternalServerError)
 		return
@@ -135,7 +133,7 @@ func handleAccountLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = account.Logout(token)
+	err = account.Logout(r.Context(), token)
 	if err != nil {
 		httpError(w, r, err, http.StatusInternalServerError)
 		return
@@ -148,8 +146,8 @@ func handleAccountLogout(w http.ResponseWriter, r *http.Request) {
 
 func handleGameTitleStats(w http.ResponseWriter, r *http.Request) {
 	err := json.NewEncoder(w).Encode(defs.TitleStats{
-		PlayerCount: playerCount,
-		BattleCount: battleCount,
+		PlayerCount: int(playerCount.Load()),
+		BattleCount: int(battleCount.Load()),
 	})
 	if err != nil {
 		httpError(w, r, fmt.Errorf("failed to encode response json: %s", err), http.StatusInternalServerError)
@@ -160,181 +158,170 @@ func handleGameTitleStats(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleGameClassicSessionCount(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte(strconv.Itoa(classicSessionCount)))
+	w.Write([]byte(strconv.Itoa(int(classicSessionCount.Load()))))
 }
 
-func handleSaveData(w http.ResponseWriter, r *http.Request) {
+// savedata
+
+func handleSaveDataGet(w http.ResponseWriter, r *http.Request) {
 	uuid, err := uuidFromRequest(r)
 	if err != nil {
 		httpError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	datatype := -1
-	if r.URL.Query().Has("datatype") {
-		datatype, err = strconv.Atoi(r.URL.Query().Get("datatype"))
-		if err != nil {
-			httpError(w, r, err, http.StatusBadRequest)
-			return
-		}
+	datatype, slot, err := saveDataParamsFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
 	}
 
-	var slot int
-	if r.URL.Query().Has("slot") {
-		slot, err = strconv.Atoi(r.URL.Query().Get("slot"))
-		if err != nil {
-			httpError(w, r, err, http.StatusBadRequest)
+	switch datatype {
+	case datatypeSystem:
+		if slot != 0 {
+			httpError(w, r, fmt.Errorf("invalid slot id for system data"), http.StatusInternalServerError)
 			return
 		}
+
+		serveSystemGet(w, r, uuid)
+	case datatypeSession:
+		serveSessionGet(w, r, uuid, slot)
+	default:
+		httpError(w, r, fmt.Errorf("invalid data type"), http.StatusInternalServerError)
 	}
+}
 
-	var save any
-	// /savedata/get and /savedata/delete specify datatype, but don't expect data in body
-	if r.URL.Path != "/savedata/get" && r.URL.Path != "/savedata/delete" {
-		if datatype == 0 {
-			var system defs.SystemSaveData
-			err = json.NewDecoder(r.Body).Decode(&system)
-			if err != nil {
-				httpError(w, r, fmt.Errorf("failed to decode request body: %s", err), http.StatusBadRequest)
-				return
-			}
-
-			save = system
-			// /savedata/clear doesn't specify datatype, it is assumed to be 1 (session)
-		} else if datatype == 1 || r.URL.Path == "/savedata/clear" {
-			var session defs.SessionSaveData
-			err = json.NewDecoder(r.Body).Decode(&session)
-			if err != nil {
-				httpError(w, r, fmt.Errorf("failed to decode request body: %s", err), http.StatusBadRequest)
-				return
-			}
-
-			save = session
-		}
+func handleSaveDataUpdate(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
 	}
 
-	var token []byte
-	token, err = tokenFromRequest(r)
+	datatype, slot, err := saveDataParamsFromQuery(r)
 	if err != nil {
 		httpError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	var active bool
-	if r.URL.Path == "/savedata/get" {
-		if datatype == 0 {
-			err = db.UpdateActiveSession(uuid, token)
-			if err != nil {
-				httpError(w, r, fmt.Errorf("failed to update active session: %s", err), http.StatusBadRequest)
-				return
-			}
-		}
-	} else {
-		active, err = db.IsActiveSession(token)
+	switch datatype {
+	case datatypeSystem:
+		var system defs.SystemSaveData
+		err = readJSON(r, &system)
 		if err != nil {
-			httpError(w, r, fmt.Errorf("failed to check active session: %s", err), http.StatusBadRequest)
+			httpError(w, r, err, http.StatusBadRequest)
 			return
 		}
 
-		// TODO: make this not suck
-		if !active && r.URL.Path != "/savedata/clear" {
-			httpError(w, r, fmt.Errorf("session out of date"), http.StatusBadRequest)
+		serveSystemUpdate(w, r, uuid, system)
+	case datatypeSession:
+		var session defs.SessionSaveData
+		err = readJSON(r, &session)
+		if err != nil {
+			httpError(w, r, err, http.StatusBadRequest)
 			return
 		}
 
-		var trainerId, secretId int
-
-		if r.URL.Path != "/savedata/update" || datatype == 1 {
-			if r.URL.Query().Has("trainerId") && r.URL.Query().Has("secretId") {
-				trainerId, err = strconv.Atoi(r.URL.Query().Get("trainerId"))
-				if err != nil {
-					httpError(w, r, err, http.StatusBadRequest)
-					return
-				}
-
-				secretId, err = strconv.Atoi(r.URL.Query().Get("secretId"))
-				if err != nil {
-					httpError(w, r, err, http.StatusBadRequest)
-					return
-				}
-			}
-		} else {
-			trainerId = save.(defs.SystemSaveData).TrainerId
-			secretId = save.(defs.SystemSaveData).SecretId
-		}
-
-		storedTrainerId, storedSecretId, err := db.FetchTrainerIds(uuid)
+		trainerId, secretId, err := trainerIdsFromQuery(r)
 		if err != nil {
-			httpError(w, r, err, http.StatusInternalServerError)
+			httpError(w, r, err, http.StatusBadRequest)
 			return
 		}
 
-		if storedTrainerId > 0 || storedSecretId > 0 {
-			if trainerId != storedTrainerId || secretId != storedSecretId {
-				httpError(w, r, fmt.Errorf("session out of date"), http.StatusBadRequest)
-				return
-			}
-		} else {
-			db.UpdateTrainerIds(trainerId, secretId, uuid)
-		}
+		serveSessionUpdate(w, r, uuid, slot, trainerId, secretId, session)
+	default:
+		httpError(w, r, fmt.Errorf("invalid data type"), http.StatusInternalServerError)
 	}
+}
 
-	switch r.URL.Path {
-	case "/savedata/get":
-		save, err = savedata.Get(uuid, datatype, slot)
-		if err == sql.ErrNoRows {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-	case "/savedata/update":
-		err = savedata.Update(uuid, slot, save)
-	case "/savedata/delete":
-		err = savedata.Delete(uuid, datatype, slot)
-	case "/savedata/clear":
-		if !active {
-			// TODO: make this not suck
-			save = savedata.ClearResponse{Error: "session out of date"}
-			break
-		}
+func handleSaveDataDelete(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
 
-		s, ok := save.(defs.SessionSaveData)
-		if !ok {
-			err = fmt.Errorf("save data is not type SessionSaveData")
-			break
-		}
+	datatype, slot, err := saveDataParamsFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
 
-		// doesn't return a save, but it works
-		var seed string
-		seed, err = db.GetDailyRunSeed()
-		if err != nil {
-			httpError(w, r, err, http.StatusInternalServerError)
-			return
-		}
-		save, err = savedata.Clear(uuid, slot, seed, s)
+	trainerId, secretId, err := trainerIdsFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	switch datatype {
+	case datatypeSystem:
+		serveSystemDelete(w, r, uuid, trainerId, secretId)
+	case datatypeSession:
+		serveSessionDelete(w, r, uuid, slot, trainerId, secretId)
+	default:
+		httpError(w, r, fmt.Errorf("invalid data type"), http.StatusInternalServerError)
 	}
+}
+
+func handleSaveDataClear(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
 	if err != nil {
-		httpError(w, r, err, http.StatusInternalServerError)
+		httpError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	if save == nil || r.URL.Path == "/savedata/update" {
-		w.WriteHeader(http.StatusOK)
+	// /savedata/clear doesn't specify datatype, it is assumed to be 1 (session)
+	_, slot, err := saveDataParamsFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(save)
+	var session defs.SessionSaveData
+	err = readJSON(r, &session)
 	if err != nil {
-		httpError(w, r, fmt.Errorf("failed to encode response json: %s", err), http.StatusInternalServerError)
+		httpError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	trainerId, secretId, err := trainerIdsFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	serveSessionClear(w, r, uuid, slot, trainerId, secretId, session)
+}
+
+func saveDataParamsFromQuery(r *http.Request) (datatype, slot int, err error) {
+	datatype = -1
+	if r.URL.Query().Has("datatype") {
+		datatype, err = strconv.Atoi(r.URL.Query().Get("datatype"))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if r.URL.Query().Has("slot") {
+		slot, err = strconv.Atoi(r.URL.Query().Get("slot"))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return datatype, slot, nil
 }
 
 // daily
 
 func handleDailySeed(w http.ResponseWriter, r *http.Request) {
-	seed, err := db.GetDailyRunSeed()
+	challenge := challengeFromQuery(r)
+	if _, ok := daily.Challenge(challenge); !ok {
+		httpError(w, r, fmt.Errorf("unknown challenge %q", challenge), http.StatusBadRequest)
+		return
+	}
+
+	seed, err := daily.ChallengeSeed(r.Context(), challenge)
 	if err != nil {
 		httpError(w, r, err, http.StatusInternalServerError)
 		return
@@ -352,32 +339,40 @@ func handleDailySeed(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleDailyRankings(w http.ResponseWriter, r *http.Request) {
-	var err error
+	board, err := leaderboardFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
 
-	var category int
-	if r.URL.Query().Has("category") {
-		category, err = strconv.Atoi(r.URL.Query().Get("category"))
-		if err != nil {
-			httpError(w, r, fmt.Errorf("failed to convert category: %s", err), http.StatusBadRequest)
-			return
-		}
+	page, err := pageFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
 	}
 
-	page := 1
-	if r.URL.Query().Has("page") {
-		page, err = strconv.Atoi(r.URL.Query().Get("page"))
-		if err != nil {
-			httpError(w, r, fmt.Errorf("failed to convert page: %s", err), http.StatusBadRequest)
-			return
-		}
+	limit, err := limitFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
 	}
 
-	rankings, err := daily.Rankings(category, page)
+	cursor, err := cursorFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	rankings, version, err := daily.Rankings(r.Context(), board, page, limit, cursor)
 	if err != nil {
 		httpError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
+	if notModified(w, r, version) {
+		return
+	}
+
 	err = json.NewEncoder(w).Encode(rankings)
 	if err != nil {
 		httpError(w, r, fmt.Errorf("failed to encode response json: %s", err), http.StatusInternalServerError)
@@ -388,20 +383,27 @@ func handleDailyRankings(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleDailyRankingPageCount(w http.ResponseWriter, r *http.Request) {
-	var category int
-	if r.URL.Query().Has("category") {
-		var err error
-		category, err = strconv.Atoi(r.URL.Query().Get("category"))
-		if err != nil {
-			httpError(w, r, fmt.Errorf("failed to convert category: %s", err), http.StatusBadRequest)
-			return
-		}
+	board, err := leaderboardFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
 	}
 
-	count, err := daily.RankingPageCount(category)
+	limit, err := limitFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	count, version, err := daily.RankingPageCount(r.Context(), board, limit)
 	if err != nil {
 		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if notModified(w, r, version) {
+		return
 	}
 
-	w.Write([]byte(strconv.Itoa(count)))
+	w.Write([]byte(strconv.Itoa(count.PageCount)))
 }
@@ -0,0 +1,383 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pagefaultgames/rogueserver/api/account"
+	"github.com/pagefaultgames/rogueserver/api/daily"
+	"github.com/pagefaultgames/rogueserver/api/savedata"
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+/*
+	v2 endpoints take JSON request bodies and always respond with JSON.
+	Endpoints whose v1 counterpart already does both are registered with the v1 handler.
+*/
+
+// account
+
+func handleV2AccountRegister(w http.ResponseWriter, r *http.Request) {
+	var request account.GenericAuthRequest
+	err := readJSON(r, &request)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	err = account.Register(r.Context(), request.Username, request.Password)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleV2AccountLogin(w http.ResponseWriter, r *http.Request) {
+	var request account.GenericAuthRequest
+	err := readJSON(r, &request)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	response, err := account.Login(r.Context(), request.Username, request.Password)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, response)
+}
+
+func handleV2AccountChangePW(w http.ResponseWriter, r *http.Request) {
+	var request account.ChangePWRequest
+	err := readJSON(r, &request)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	err = account.ChangePW(r.Context(), uuid, request.Password)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// game
+
+func handleV2GameClassicSessionCount(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, defs.ClassicSessionCount{ClassicSessionCount: int(classicSessionCount.Load())})
+}
+
+// savedata
+
+func handleV2SystemGet(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	serveSystemGet(w, r, uuid)
+}
+
+func handleV2SystemUpdate(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	var system defs.SystemSaveData
+	err = readJSON(r, &system)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	serveSystemUpdate(w, r, uuid, system)
+}
+
+func handleV2SystemDelete(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	var request savedata.TrainerIdsRequest
+	err = readJSON(r, &request)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	serveSystemDelete(w, r, uuid, request.TrainerId, request.SecretId)
+}
+
+func handleV2SessionGet(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	slot, err := slotFromPath(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	serveSessionGet(w, r, uuid, slot)
+}
+
+func handleV2SessionUpdate(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	slot, err := slotFromPath(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	var request savedata.SessionRequest
+	err = readJSON(r, &request)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	serveSessionUpdate(w, r, uuid, slot, request.TrainerId, request.SecretId, request.Session)
+}
+
+func handleV2SessionDelete(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	slot, err := slotFromPath(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	var request savedata.TrainerIdsRequest
+	err = readJSON(r, &request)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	serveSessionDelete(w, r, uuid, slot, request.TrainerId, request.SecretId)
+}
+
+func handleV2SessionClear(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	slot, err := slotFromPath(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	var request savedata.SessionRequest
+	err = readJSON(r, &request)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	serveSessionClear(w, r, uuid, slot, request.TrainerId, request.SecretId, request.Session)
+}
+
+// daily
+
+func handleV2DailySeed(w http.ResponseWriter, r *http.Request) {
+	challenge, ok := daily.Challenge(challengeFromQuery(r))
+	if !ok {
+		httpError(w, r, fmt.Errorf("unknown challenge %q", challengeFromQuery(r)), http.StatusBadRequest)
+		return
+	}
+
+	seed, err := daily.ChallengeSeed(r.Context(), challenge.Id)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, daily.SeedResponse{Seed: seed, Challenge: challenge})
+}
+
+// /v2/daily/challenges - list the daily challenges
+func handleV2DailyChallenges(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, daily.Challenges)
+}
+
+func handleV2DailyRankingPageCount(w http.ResponseWriter, r *http.Request) {
+	board, err := leaderboardFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	limit, err := limitFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	count, version, err := daily.RankingPageCount(r.Context(), board, limit)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if notModified(w, r, version) {
+		return
+	}
+
+	writeJSON(w, r, count)
+}
+
+// maximum number of rankings above and below the player's in /v2/daily/rankings/me
+const maxRankingNeighbours = 25
+
+// /v2/daily/rankings/me - get the logged in account's ranking and the rankings around it
+func handleV2DailyRankingPosition(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	board, err := leaderboardFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	neighbours := 5
+	if r.URL.Query().Has("neighbours") {
+		neighbours, err = strconv.Atoi(r.URL.Query().Get("neighbours"))
+		if err != nil {
+			httpError(w, r, fmt.Errorf("failed to convert neighbours: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if neighbours < 0 || neighbours > maxRankingNeighbours {
+			httpError(w, r, fmt.Errorf("neighbours must be within 0 and %d", maxRankingNeighbours), http.StatusBadRequest)
+			return
+		}
+	}
+
+	position, version, err := daily.Position(r.Context(), uuid, board, neighbours)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, fmt.Errorf("no ranked run in this category"), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	// the response depends on the account as well as the leaderboard
+	w.Header().Add("Vary", "Authorization")
+	if notModified(w, r, version) {
+		return
+	}
+
+	writeJSON(w, r, position)
+}
+
+// /v2/daily/categories - list the ranking categories
+func handleV2DailyCategories(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, daily.Categories)
+}
+
+// /v2/daily/seeds - list past daily seeds, newest first
+func handleV2DailySeeds(w http.ResponseWriter, r *http.Request) {
+	page, err := pageFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	challenge := challengeFromQuery(r)
+	if _, ok := daily.Challenge(challenge); !ok {
+		httpError(w, r, fmt.Errorf("unknown challenge %q", challenge), http.StatusBadRequest)
+		return
+	}
+
+	seeds, err := daily.Seeds(r.Context(), challenge, page)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, seeds)
+}
+
+// /v2/daily/commitments - list the hashes of daily seeds published before their day, newest first, with the seeds of days that started
+func handleV2DailyCommitments(w http.ResponseWriter, r *http.Request) {
+	page, err := pageFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	challenge := challengeFromQuery(r)
+	if _, ok := daily.Challenge(challenge); !ok {
+		httpError(w, r, fmt.Errorf("unknown challenge %q", challenge), http.StatusBadRequest)
+		return
+	}
+
+	commitments, err := daily.Commitments(r.Context(), challenge, page)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, commitments)
+}
@@ -0,0 +1,222 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package event
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/leaderboard"
+	"github.com/robfig/cron/v3"
+)
+
+/*
+	Events are played with their own seeds from their start to their end. Their runs are recorded as daily runs of the
+	challenge EventChallengePrefix + id and ranked by each player's best run. Once an event ends the scheduler delivers
+	its rewards as compensations. The running and upcoming events are kept in memory, refreshed by the scheduler and
+	whenever a moderator changes an event on this instance.
+*/
+
+var (
+	scheduler = cron.New(cron.WithLocation(time.UTC))
+
+	// unfinished are the running and upcoming events
+	unfinished   []defs.Event
+	unfinishedMu sync.RWMutex
+)
+
+func Init() error {
+	refresh(context.Background())
+
+	_, err := scheduler.AddFunc("@every 1m", func() {
+		ctx := context.Background()
+
+		refresh(ctx)
+		reward(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	scheduler.Start()
+
+	return nil
+}
+
+// Stop stops the event scheduler, waiting for a running job to finish
+func Stop() {
+	<-scheduler.Stop().Done()
+}
+
+// refresh reloads the running and upcoming events from the database
+func refresh(ctx context.Context) {
+	events, err := db.FetchUnfinishedEvents(ctx)
+	if err != nil {
+		slog.Error("failed to refresh events", "error", err)
+		return
+	}
+
+	unfinishedMu.Lock()
+	unfinished = events
+	unfinishedMu.Unlock()
+}
+
+// reward delivers the rewards of the events that ended
+func reward(ctx context.Context) {
+	events, err := db.FetchUnrewardedEvents(ctx)
+	if err != nil {
+		slog.Error("failed to fetch ended events", "error", err)
+		return
+	}
+
+	for _, event := range events {
+		rewarded, err := db.RewardEvent(ctx, event, ChallengeId(event.Id))
+		if err != nil {
+			slog.Error("failed to deliver event rewards", "event", event.Id, "error", err)
+			continue
+		}
+
+		if rewarded {
+			slog.Info("delivered event rewards", "event", event.Id)
+		}
+	}
+}
+
+// running returns the events running at now
+func running(now time.Time) []defs.Event {
+	unfinishedMu.RLock()
+	defer unfinishedMu.RUnlock()
+
+	var events []defs.Event
+	for _, event := range unfinished {
+		if !now.Before(event.Start) && now.Before(event.End) {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// seedAt returns the seed of event played at now: one seed per day from its start, the last one until it ends
+func seedAt(event defs.Event, now time.Time) string {
+	if len(event.Seeds) == 0 {
+		return ""
+	}
+
+	day := int(now.UTC().Truncate(24*time.Hour).Sub(event.Start.UTC().Truncate(24*time.Hour)) / (24 * time.Hour))
+
+	return event.Seeds[min(max(day, 0), len(event.Seeds)-1)]
+}
+
+// ChallengeId returns the challenge the runs of the event with id are recorded under
+func ChallengeId(id int) string {
+	return defs.EventChallengePrefix + strconv.Itoa(id)
+}
+
+// eventId returns the id of the event whose runs are recorded under challenge, false if challenge isn't an event's
+func eventId(challenge string) (int, bool) {
+	id, found := strings.CutPrefix(challenge, defs.EventChallengePrefix)
+	if !found {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// challenge returns event as the challenge its runs are recorded under
+func challenge(event defs.Event) defs.DailyChallenge {
+	return defs.DailyChallenge{Id: ChallengeId(event.Id), Name: event.Name, GameMode: event.GameMode, Waves: event.Waves, Rules: event.Rules}
+}
+
+// key returns the key of the leaderboard of event
+func key(event defs.Event) leaderboard.Key {
+	return leaderboard.Key{Challenge: ChallengeId(event.Id), Aggregate: "best", From: event.Start.UTC().Format(time.DateOnly), To: event.End.UTC().Format(time.DateOnly)}
+}
+
+// ActiveChallenge returns the challenge of the running event that seed is the current seed of, nil if there is none
+func ActiveChallenge(seed string) *defs.DailyChallenge {
+	now := time.Now().UTC()
+	for _, event := range running(now) {
+		if seedAt(event, now) == seed {
+			challenge := challenge(event)
+			return &challenge
+		}
+	}
+
+	return nil
+}
+
+// IsEventMode reports whether any running event is played in mode
+func IsEventMode(mode int) bool {
+	for _, event := range running(time.Now().UTC()) {
+		if event.GameMode == mode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RecordRun updates the cached leaderboard of the running event with the run of challenge of uuid, if challenge is an event's
+func RecordRun(ctx context.Context, uuid []byte, challenge string) error {
+	id, ok := eventId(challenge)
+	if !ok || leaderboard.Backend == nil {
+		return nil
+	}
+
+	for _, event := range running(time.Now().UTC()) {
+		if event.Id != id {
+			continue
+		}
+
+		run, err := db.FetchRankedDailyRun(ctx, uuid, challenge)
+		if err != nil {
+			return err
+		}
+
+		return leaderboard.Record(ctx, []leaderboard.Key{key(event)}, run)
+	}
+
+	return nil
+}
+
+// RefreshRankings rebuilds the cached leaderboard of the event whose runs are recorded under challenge, if challenge is an event's
+func RefreshRankings(ctx context.Context, challenge string) error {
+	id, ok := eventId(challenge)
+	if !ok || leaderboard.Backend == nil {
+		return nil
+	}
+
+	event, err := db.FetchEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return leaderboard.Refresh(ctx, []leaderboard.Key{key(event)})
+}
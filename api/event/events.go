@@ -0,0 +1,175 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package event
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pagefaultgames/rogueserver/api/daily"
+	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/leaderboard"
+)
+
+// /events - fetch a page of events, latest start first
+func Events(ctx context.Context, page int) ([]defs.Event, error) {
+	events, err := db.FetchEvents(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	for i := range events {
+		events[i] = public(events[i], now)
+	}
+
+	return events, nil
+}
+
+// /events/{id} - fetch an event, sql.ErrNoRows if there is none
+func Event(ctx context.Context, id int) (defs.Event, error) {
+	event, err := db.FetchEvent(ctx, id)
+	if err != nil {
+		return event, err
+	}
+
+	return public(event, time.Now().UTC()), nil
+}
+
+// /events/{id}/rankings - fetch up to limit rankings of an event after cursor, or of page if cursor is nil, sql.ErrNoRows if there is no such event
+func Rankings(ctx context.Context, id, page, limit int, cursor *defs.RankingCursor) ([]defs.DailyRanking, leaderboard.Version, error) {
+	event, err := db.FetchEvent(ctx, id)
+	if err != nil {
+		return nil, leaderboard.Version{}, err
+	}
+
+	return daily.RankingsOf(ctx, key(event), page, limit, cursor)
+}
+
+// public hides the seeds of event, showing the one played at now if it is running
+func public(event defs.Event, now time.Time) defs.Event {
+	if !now.Before(event.Start) && now.Before(event.End) {
+		event.Seed = seedAt(event, now)
+	}
+
+	event.Seeds = nil
+
+	return event
+}
+
+// Validate checks an event a moderator submitted
+func Validate(event defs.Event) error {
+	if event.Name == "" || len(event.Name) > 64 {
+		return fmt.Errorf("event name must be 1 to 64 characters")
+	}
+
+	if !event.End.After(event.Start) {
+		return fmt.Errorf("event must end after it starts")
+	}
+
+	if event.GameMode < 0 {
+		return fmt.Errorf("invalid game mode %d", event.GameMode)
+	}
+
+	if event.Waves < 1 {
+		return fmt.Errorf("event waves must be positive")
+	}
+
+	for _, seed := range event.Seeds {
+		bytes, err := base64.StdEncoding.DecodeString(seed)
+		if err != nil || len(bytes) != 16 {
+			return fmt.Errorf("invalid seed %q: must be 16 bytes encoded as base64 like daily seeds", seed)
+		}
+	}
+
+	for _, reward := range event.Rewards {
+		if reward.Rank < 0 || reward.VoucherType < 0 || reward.Count < 1 {
+			return fmt.Errorf("invalid reward of %d vouchers of type %d for rank %d", reward.Count, reward.VoucherType, reward.Rank)
+		}
+	}
+
+	return nil
+}
+
+// Create stores a new event, with a random seed if it has none, and returns it with its id
+func Create(ctx context.Context, event defs.Event) (defs.Event, error) {
+	if len(event.Seeds) == 0 {
+		seed := make([]byte, 16)
+		_, err := rand.Read(seed)
+		if err != nil {
+			return event, fmt.Errorf("failed to generate event seed: %s", err)
+		}
+
+		event.Seeds = []string{base64.StdEncoding.EncodeToString(seed)}
+	}
+
+	var err error
+	event.Id, err = db.AddEvent(ctx, event)
+	if err != nil {
+		return event, err
+	}
+
+	event.Seed, event.Rewarded = "", false
+
+	refresh(ctx)
+
+	return event, nil
+}
+
+// Update replaces an event that wasn't rewarded yet, keeping its seeds if event has none, false if there is no such event
+func Update(ctx context.Context, event defs.Event) (bool, error) {
+	if len(event.Seeds) == 0 {
+		stored, err := db.FetchEvent(ctx, event.Id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		event.Seeds = stored.Seeds
+	}
+
+	updated, err := db.UpdateEvent(ctx, event)
+	if err != nil {
+		return false, err
+	}
+
+	refresh(ctx)
+
+	return updated, nil
+}
+
+// Delete deletes an event that hasn't started, false if there is none
+func Delete(ctx context.Context, id int) (bool, error) {
+	deleted, err := db.DeleteEvent(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	refresh(ctx)
+
+	return deleted, nil
+}
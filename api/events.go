@@ -0,0 +1,246 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pagefaultgames/rogueserver/api/event"
+	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+// /v2/events - list events, latest start first
+func handleV2Events(w http.ResponseWriter, r *http.Request) {
+	page, err := pageFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	events, err := event.Events(r.Context(), page)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, events)
+}
+
+// /v2/events/{id} - get an event with the seed played now, if it is running
+func handleV2Event(w http.ResponseWriter, r *http.Request) {
+	id, err := eventIdFromPath(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	e, err := event.Event(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, fmt.Errorf("no event with id %d", id), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, e)
+}
+
+// /v2/events/{id}/rankings - get the rankings of an event by each player's best run
+func handleV2EventRankings(w http.ResponseWriter, r *http.Request) {
+	id, err := eventIdFromPath(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	page, err := pageFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	limit, err := limitFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := cursorFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	rankings, version, err := event.Rankings(r.Context(), id, page, limit, cursor)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, fmt.Errorf("no event with id %d", id), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if notModified(w, r, version) {
+		return
+	}
+
+	writeJSON(w, r, rankings)
+}
+
+// /v2/moderation/events - list events with their seeds, latest start first
+func handleV2ModerationEvents(w http.ResponseWriter, r *http.Request) {
+	_, code, err := moderatorFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, code)
+		return
+	}
+
+	page, err := pageFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	events, err := db.FetchEvents(r.Context(), page)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, events)
+}
+
+// /v2/moderation/events - create an event, with a random seed if it has none
+func handleV2EventCreate(w http.ResponseWriter, r *http.Request) {
+	_, code, err := moderatorFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, code)
+		return
+	}
+
+	var e defs.Event
+	err = readJSON(r, &e)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	err = event.Validate(e)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	e, err = event.Create(r.Context(), e)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, e)
+}
+
+// /v2/moderation/events/{id} - replace an event that wasn't rewarded yet, keeping its seeds if none are given
+func handleV2EventUpdate(w http.ResponseWriter, r *http.Request) {
+	_, code, err := moderatorFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, code)
+		return
+	}
+
+	id, err := eventIdFromPath(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	var e defs.Event
+	err = readJSON(r, &e)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	e.Id = id
+
+	err = event.Validate(e)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	updated, err := event.Update(r.Context(), e)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !updated {
+		httpError(w, r, fmt.Errorf("no unrewarded event with id %d", id), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// /v2/moderation/events/{id} - delete an event that hasn't started
+func handleV2EventDelete(w http.ResponseWriter, r *http.Request) {
+	_, code, err := moderatorFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, code)
+		return
+	}
+
+	id, err := eventIdFromPath(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := event.Delete(r.Context(), id)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !deleted {
+		httpError(w, r, fmt.Errorf("no upcoming event with id %d", id), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func eventIdFromPath(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert id: %s", err)
+	}
+
+	return id, nil
+}
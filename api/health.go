@@ -0,0 +1,128 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/gameversion"
+)
+
+// commit is the vcs revision the binary was built from, if the go toolchain recorded one
+var commit = func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	revision, modified := "unknown", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+
+	if modified {
+		revision += "-dirty"
+	}
+
+	return revision
+}()
+
+// /healthz - the process is up and serving requests
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// readinessTTL is how long a readiness result is reused, so that frequent probes don't each query the database
+const readinessTTL = 5 * time.Second
+
+var (
+	readinessLock    sync.Mutex
+	readinessChecked time.Time
+	readiness        defs.Readiness
+)
+
+// /readyz - the database is reachable, has the expected schema and today's daily seed is recorded
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	readinessLock.Lock()
+	if time.Since(readinessChecked) >= readinessTTL {
+		// a probe that gives up early shouldn't make the next ones fail too
+		readiness = checkReadiness(context.WithoutCancel(r.Context()))
+		readinessChecked = time.Now()
+	}
+	result := readiness
+	readinessLock.Unlock()
+
+	if !result.Ready {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	writeJSON(w, r, result)
+}
+
+func checkReadiness(ctx context.Context) defs.Readiness {
+	readiness := defs.Readiness{Ready: true, Checks: make(map[string]string)}
+
+	check := func(name string, err error) {
+		if err != nil {
+			readiness.Ready = false
+			readiness.Checks[name] = err.Error()
+			return
+		}
+
+		readiness.Checks[name] = "ok"
+	}
+
+	check("database", db.Ping(ctx))
+
+	version, err := db.FetchSchemaVersion(ctx)
+	// a newer schema is fine, instances of the previous release keep serving while a new one rolls out
+	if err == nil && version < db.SchemaVersion {
+		err = fmt.Errorf("schema version is %d, expected at least %d", version, db.SchemaVersion)
+	}
+	check("schema", err)
+
+	_, err = db.GetDailyRunSeed(ctx)
+	check("dailySeed", err)
+
+	return readiness
+}
+
+// /version - build and protocol versions
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	supported := gameversion.Current()
+
+	writeJSON(w, r, defs.VersionInfo{
+		Commit:         commit,
+		SchemaVersion:  db.SchemaVersion,
+		MinGameVersion: supported.Min,
+		MaxGameVersion: supported.Max,
+	})
+}
@@ -0,0 +1,105 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pagefaultgames/rogueserver/api/savedata"
+)
+
+func handleV2History(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	page, err := pageFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	entries, err := savedata.History(r.Context(), uuid, page)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, entries)
+}
+
+func handleV2HistoryEntry(w http.ResponseWriter, r *http.Request) {
+	uuid, err := uuidFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, fmt.Errorf("failed to convert id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	entry, err := savedata.HistoryEntry(r.Context(), uuid, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, fmt.Errorf("no run with id %d", id), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, entry)
+}
+
+func handleV2ModerationHistory(w http.ResponseWriter, r *http.Request) {
+	_, code, err := moderatorFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, code)
+		return
+	}
+
+	seed := r.URL.Query().Get("seed")
+	if seed == "" {
+		httpError(w, r, fmt.Errorf("missing seed"), http.StatusBadRequest)
+		return
+	}
+
+	page, err := pageFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	entries, err := savedata.HistoryBySeed(r.Context(), seed, page)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, entries)
+}
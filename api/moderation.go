@@ -0,0 +1,146 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pagefaultgames/rogueserver/api/daily"
+	"github.com/pagefaultgames/rogueserver/api/event"
+	"github.com/pagefaultgames/rogueserver/api/savedata"
+	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+// /v2/moderation/savedata/findings - list save data validation findings, newest first
+func handleV2SaveDataFindings(w http.ResponseWriter, r *http.Request) {
+	_, code, err := moderatorFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, code)
+		return
+	}
+
+	action := r.URL.Query().Get("action")
+	switch savedata.Action(action) {
+	case "", savedata.ActionClamp, savedata.ActionFlag, savedata.ActionReject:
+	default:
+		httpError(w, r, fmt.Errorf("invalid action %q", action), http.StatusBadRequest)
+		return
+	}
+
+	page, err := pageFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	findings, err := db.FetchSaveDataFindings(r.Context(), r.URL.Query().Get("username"), action, page)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, findings)
+}
+
+// /v2/moderation/daily/hidden - list daily runs hidden from rankings, newest first
+func handleV2HiddenDailyRuns(w http.ResponseWriter, r *http.Request) {
+	_, code, err := moderatorFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, code)
+		return
+	}
+
+	page, err := pageFromQuery(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	runs, err := db.FetchHiddenDailyRuns(r.Context(), page)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, runs)
+}
+
+// /v2/moderation/daily/review - hide a daily run from rankings or show it
+func handleV2DailyRunReview(w http.ResponseWriter, r *http.Request) {
+	_, code, err := moderatorFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, code)
+		return
+	}
+
+	var review defs.DailyRunReview
+	err = readJSON(r, &review)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	date, err := time.Parse(time.DateOnly, review.Date)
+	if err != nil {
+		httpError(w, r, fmt.Errorf("invalid date %q", review.Date), http.StatusBadRequest)
+		return
+	}
+
+	if review.Challenge == "" {
+		review.Challenge = defs.DefaultDailyChallenge
+	}
+
+	found, err := db.SetDailyRunHidden(r.Context(), review.Username, review.Date, review.Challenge, review.Hidden)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		httpError(w, r, fmt.Errorf("no %s run of %q on %s", review.Challenge, review.Username, review.Date), http.StatusNotFound)
+		return
+	}
+
+	err = daily.RefreshRankings(r.Context(), review.Challenge, date)
+	if err == nil {
+		err = event.RefreshRankings(r.Context(), review.Challenge)
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to refresh cached leaderboards", "error", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func pageFromQuery(r *http.Request) (int, error) {
+	if !r.URL.Query().Has("page") {
+		return 1, nil
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 0, fmt.Errorf("invalid page %q", r.URL.Query().Get("page"))
+	}
+
+	return page, nil
+}
@@ -0,0 +1,287 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/gameversion"
+)
+
+// openAPIVersion is the version of the document itself, bump it whenever the routes table changes
+const openAPIVersion = "2.14.0"
+
+var (
+	openAPIDocument []byte
+
+	pathParamPattern = regexp.MustCompile(`{(\w+)}`)
+
+	// schemaOverrides describe types with their own JSON encoding
+	schemaOverrides = map[reflect.Type]openAPISchema{
+		reflect.TypeOf(defs.DexAttr(0)): {"type": "string", "format": "uint64"},
+		reflect.TypeOf(time.Time{}):     {"type": "string", "format": "date-time"},
+		reflect.TypeOf(defs.StarterMoveset{}): {"oneOf": []openAPISchema{
+			{"type": "array", "items": openAPISchema{"type": "integer"}},
+			{"type": "object", "additionalProperties": openAPISchema{"type": "array", "items": openAPISchema{"type": "integer"}}},
+		}},
+	}
+)
+
+type openAPISchema map[string]any
+
+// oneOf is the body of a route that decodes or encodes one of several types, e.g. depending on a query parameter
+type oneOf []any
+
+type openAPIParameter struct {
+	Name     string        `json:"name"`
+	In       string        `json:"in"`
+	Required bool          `json:"required"`
+	Schema   openAPISchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]openAPISchema `json:"schemas"`
+	SecuritySchemes map[string]openAPISchema `json:"securitySchemes"`
+}
+
+type openAPI struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       openAPIInfo                            `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components openAPIComponents                      `json:"components"`
+}
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+func buildOpenAPIDocument(routes []route) []byte {
+	document := openAPI{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "rogueserver", Version: openAPIVersion},
+		Paths:   make(map[string]map[string]openAPIOperation),
+		Components: openAPIComponents{
+			Schemas: make(map[string]openAPISchema),
+			SecuritySchemes: map[string]openAPISchema{
+				"token": {"type": "apiKey", "in": "header", "name": "Authorization"},
+			},
+		},
+	}
+
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route.pattern, " ")
+
+		operation := openAPIOperation{
+			Summary:   route.summary,
+			Responses: make(map[string]openAPIResponse),
+		}
+
+		for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+			operation.Parameters = append(operation.Parameters, openAPIParameter{Name: match[1], In: "path", Required: true, Schema: openAPISchema{"type": "integer"}})
+		}
+
+		if !route.anyVersion {
+			operation.Parameters = append(operation.Parameters, openAPIParameter{Name: gameversion.Header, In: "header", Required: true, Schema: openAPISchema{"type": "string"}})
+		}
+
+		for _, name := range route.query {
+			operation.Parameters = append(operation.Parameters, openAPIParameter{Name: name, In: "query", Schema: openAPISchema{"type": "integer"}})
+		}
+
+		for _, name := range route.textQuery {
+			operation.Parameters = append(operation.Parameters, openAPIParameter{Name: name, In: "query", Schema: openAPISchema{"type": "string"}})
+		}
+
+		if route.request != nil {
+			operation.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{
+				"application/json": {Schema: document.bodySchema(route.request)},
+			}}
+		} else if route.form != nil {
+			operation.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{
+				"application/x-www-form-urlencoded": {Schema: document.schemaOf(reflect.TypeOf(route.form))},
+			}}
+		}
+
+		response := openAPIResponse{Description: "OK"}
+		if route.response != nil {
+			response.Content = map[string]openAPIMediaType{
+				"application/json": {Schema: document.bodySchema(route.response)},
+			}
+		} else if route.contentType == "application/json" {
+			// JSON the server doesn't encode from a Go type, e.g. this document
+			response.Content = map[string]openAPIMediaType{
+				route.contentType: {Schema: openAPISchema{"type": "object"}},
+			}
+		} else if route.contentType != "" {
+			response.Content = map[string]openAPIMediaType{
+				route.contentType: {Schema: openAPISchema{"type": "string"}},
+			}
+		}
+
+		operation.Responses["200"] = response
+		if !route.anyVersion {
+			operation.Responses["426"] = openAPIResponse{Description: "game version out of date", Content: map[string]openAPIMediaType{
+				"application/json": {Schema: document.schemaOf(reflect.TypeOf(defs.UnsupportedGameVersion{}))},
+			}}
+		}
+
+		operation.Responses["default"] = openAPIResponse{Description: "error message", Content: map[string]openAPIMediaType{
+			"text/plain": {Schema: openAPISchema{"type": "string"}},
+		}}
+
+		if route.auth {
+			operation.Security = []map[string][]string{{"token": {}}}
+		}
+
+		if document.Paths[path] == nil {
+			document.Paths[path] = make(map[string]openAPIOperation)
+		}
+
+		document.Paths[path][strings.ToLower(method)] = operation
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		// the document only contains types defined above, this can't fail
+		panic(err)
+	}
+
+	return data
+}
+
+// bodySchema is the schema of a request or response body, a zero value or a oneOf of them
+func (document *openAPI) bodySchema(body any) openAPISchema {
+	bodies, ok := body.(oneOf)
+	if !ok {
+		return document.schemaOf(reflect.TypeOf(body))
+	}
+
+	var schemas []openAPISchema
+	for _, body := range bodies {
+		schemas = append(schemas, document.schemaOf(reflect.TypeOf(body)))
+	}
+
+	return openAPISchema{"oneOf": schemas}
+}
+
+// schemaOf derives a JSON schema from a Go type the same way encoding/json would serialize it.
+// Named structs are added to the document's components and referenced.
+func (document *openAPI) schemaOf(t reflect.Type) openAPISchema {
+	if schema, ok := schemaOverrides[t]; ok {
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return document.schemaOf(t.Elem())
+	case reflect.Bool:
+		return openAPISchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openAPISchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return openAPISchema{"type": "number"}
+	case reflect.String:
+		return openAPISchema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return openAPISchema{"type": "string", "format": "byte"}
+		}
+
+		return openAPISchema{"type": "array", "items": document.schemaOf(t.Elem())}
+	case reflect.Map:
+		return openAPISchema{"type": "object", "additionalProperties": document.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return document.structSchemaOf(t)
+		}
+
+		name := t.Name()
+		if _, ok := document.Components.Schemas[name]; !ok {
+			// reserve the name first so recursive types terminate
+			document.Components.Schemas[name] = openAPISchema{}
+			document.Components.Schemas[name] = document.structSchemaOf(t)
+		}
+
+		return openAPISchema{"$ref": "#/components/schemas/" + name}
+	}
+
+	// interface{} and anything else can hold any value
+	return openAPISchema{}
+}
+
+func (document *openAPI) structSchemaOf(t reflect.Type) openAPISchema {
+	properties := make(map[string]openAPISchema)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName != "" {
+				name = tagName
+			}
+		}
+
+		properties[name] = document.schemaOf(field.Type)
+	}
+
+	return openAPISchema{"type": "object", "properties": properties}
+}
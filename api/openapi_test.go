@@ -0,0 +1,344 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/openapi.json")
+
+// TestOpenAPIVersion checks that openAPIVersion was bumped whenever the document changed, run with -update to record the new document
+func TestOpenAPIVersion(t *testing.T) {
+	document := buildOpenAPIDocument(routes)
+
+	var indented bytes.Buffer
+	err := json.Indent(&indented, document, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	indented.WriteByte('\n')
+
+	recorded, err := os.ReadFile("testdata/openapi.json")
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(indented.Bytes(), recorded) {
+		return
+	}
+
+	var previous openAPI
+	if recorded != nil {
+		err = json.Unmarshal(recorded, &previous)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if previous.Info.Version == openAPIVersion {
+		t.Fatalf("the document changed but openAPIVersion is still %s, bump it and run the test with -update", openAPIVersion)
+	}
+
+	if !*update {
+		t.Fatalf("the document of %s isn't recorded, run the test with -update", openAPIVersion)
+	}
+
+	err = os.WriteFile("testdata/openapi.json", indented.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestOpenAPIHandlers checks every route against what its handler does, by type checking the handlers' source rather than calling them:
+// the types it decodes and encodes as JSON, the query, form and path parameters it reads, and whether it authenticates the request.
+func TestOpenAPIHandlers(t *testing.T) {
+	handlers := handlerUsages(t)
+
+	for _, route := range routes {
+		name := runtime.FuncForPC(reflect.ValueOf(route.handler).Pointer()).Name()
+		name = name[strings.LastIndex(name, ".")+1:]
+
+		used, ok := handlers[name]
+		if !ok {
+			t.Errorf("%s: no handler %s in the package", route.pattern, name)
+			continue
+		}
+
+		check := func(what string, got, declared []string) {
+			sort.Strings(declared)
+			declared = slices.Compact(declared)
+
+			if !slices.Equal(got, declared) {
+				t.Errorf("%s: %s %s %v, the route declares %v", route.pattern, name, what, got, declared)
+			}
+		}
+
+		check("encodes", used.responses, bodyTypes(route.response))
+		check("decodes", used.requests, bodyTypes(route.request))
+		check("reads the query parameters", used.query, append(slices.Clone(route.query), route.textQuery...))
+		check("reads the form fields", used.form, formFields(route.form))
+		check("reads the path parameters", used.path, pathParams(route.pattern))
+
+		if used.raw && route.contentType == "" {
+			t.Errorf("%s: %s writes a body that isn't encoded JSON, the route declares no content type", route.pattern, name)
+		}
+
+		if used.auth != route.auth {
+			t.Errorf("%s: %s authenticates the request: %t, the route declares auth: %t", route.pattern, name, used.auth, route.auth)
+		}
+	}
+}
+
+// usage is what a handler does with its request and response, including through the functions of the package it calls
+type usage struct {
+	responses []string // types encoded as JSON
+	raw       bool     // whether anything else is written
+	requests  []string // types decoded from JSON
+	query     []string
+	form      []string
+	path      []string
+	auth      bool
+}
+
+// handlerUsages type checks the package and returns the usage of each of its functions
+func handlerUsages(t *testing.T) map[string]usage {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, ".", func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []*ast.File
+	for _, file := range packages["api"].Files {
+		files = append(files, file)
+	}
+
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue), Uses: make(map[*ast.Ident]types.Object)}
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err = config.Check("github.com/pagefaultgames/rogueserver/api", fset, files, info)
+	if err != nil {
+		t.Fatalf("failed to type check the package: %s", err)
+	}
+
+	functions := make(map[string]*ast.FuncDecl)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if function, ok := decl.(*ast.FuncDecl); ok && function.Recv == nil {
+				functions[function.Name.Name] = function
+			}
+		}
+	}
+
+	const pkg = "github.com/pagefaultgames/rogueserver/api"
+
+	qualifier := func(p *types.Package) string { return p.Path() }
+
+	typeOf := func(expr ast.Expr) string {
+		return types.TypeString(info.Types[expr].Type, qualifier)
+	}
+
+	// decoded types are passed by pointer
+	elemOf := func(expr ast.Expr) string {
+		if pointer, ok := info.Types[expr].Type.(*types.Pointer); ok {
+			return types.TypeString(pointer.Elem(), qualifier)
+		}
+
+		return typeOf(expr)
+	}
+
+	stringArg := func(call *ast.CallExpr) string {
+		value := info.Types[call.Args[0]].Value
+		if value == nil || value.Kind() != constant.String {
+			t.Fatalf("%s: parameter name isn't a constant string", fset.Position(call.Pos()))
+		}
+
+		return constant.StringVal(value)
+	}
+
+	var collect func(name string, seen map[string]bool, found *usage)
+	collect = func(name string, seen map[string]bool, found *usage) {
+		if seen[name] || functions[name] == nil {
+			return
+		}
+		seen[name] = true
+
+		ast.Inspect(functions[name].Body, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+
+			var callee types.Object
+			var receiver ast.Expr
+			switch fun := call.Fun.(type) {
+			case *ast.Ident:
+				callee = info.Uses[fun]
+			case *ast.SelectorExpr:
+				callee = info.Uses[fun.Sel]
+				receiver = fun.X
+			}
+
+			function, ok := callee.(*types.Func)
+			if !ok {
+				return true
+			}
+
+			local := function.Pkg() != nil && function.Pkg().Path() == pkg
+
+			switch {
+			case local && function.Name() == "writeJSON":
+				found.responses = append(found.responses, typeOf(call.Args[2]))
+			case local && function.Name() == "readJSON":
+				found.requests = append(found.requests, elemOf(call.Args[1]))
+			case local && function.Name() == "tokenFromRequest":
+				found.auth = true
+			case function.FullName() == "(*encoding/json.Encoder).Encode":
+				found.responses = append(found.responses, typeOf(call.Args[0]))
+			case function.FullName() == "(*encoding/json.Decoder).Decode":
+				found.requests = append(found.requests, elemOf(call.Args[0]))
+			case function.FullName() == "(net/http.ResponseWriter).Write":
+				found.raw = true
+			case function.FullName() == "(*net/http.Request).PathValue":
+				found.path = append(found.path, stringArg(call))
+			case function.FullName() == "(*net/http.Request).FormValue", function.FullName() == "(*net/http.Request).PostFormValue":
+				found.form = append(found.form, stringArg(call))
+			case function.FullName() == "(net/url.Values).Get", function.FullName() == "(net/url.Values).Has":
+				// r.URL.Query() holds the query parameters, r.Form and r.PostForm the form fields
+				if query, ok := receiver.(*ast.CallExpr); ok {
+					if selector, ok := query.Fun.(*ast.SelectorExpr); ok && selector.Sel.Name == "Query" {
+						found.query = append(found.query, stringArg(call))
+						break
+					}
+				}
+
+				found.form = append(found.form, stringArg(call))
+			case local:
+				collect(function.Name(), seen, found)
+			}
+
+			return true
+		})
+	}
+
+	handlers := make(map[string]usage)
+	for name := range functions {
+		var found usage
+		collect(name, make(map[string]bool), &found)
+
+		for _, names := range []*[]string{&found.responses, &found.requests, &found.query, &found.form, &found.path} {
+			sort.Strings(*names)
+			*names = slices.Compact(*names)
+		}
+
+		handlers[name] = found
+	}
+
+	return handlers
+}
+
+// bodyTypes names the types of a route's request or response body
+func bodyTypes(body any) []string {
+	var names []string
+	if bodies, ok := body.(oneOf); ok {
+		for _, body := range bodies {
+			names = append(names, typeName(reflect.TypeOf(body)))
+		}
+	} else if body != nil {
+		names = append(names, typeName(reflect.TypeOf(body)))
+	}
+
+	return names
+}
+
+// formFields names the fields of a route's form body
+func formFields(form any) []string {
+	var names []string
+	if form == nil {
+		return names
+	}
+
+	for name := range jsonFieldNames(reflect.TypeOf(form)) {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for _, field := range reflect.VisibleFields(t) {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		if field.IsExported() && name != "-" {
+			names[name] = true
+		}
+	}
+
+	return names
+}
+
+// pathParams names the wildcards in a route's pattern
+func pathParams(pattern string) []string {
+	var names []string
+	for _, match := range pathParamPattern.FindAllStringSubmatch(pattern, -1) {
+		names = append(names, match[1])
+	}
+
+	return names
+}
+
+// typeName names t the way types.TypeString does with package paths
+func typeName(t reflect.Type) string {
+	switch {
+	case t.Name() != "" && t.PkgPath() != "":
+		return t.PkgPath() + "." + t.Name()
+	case t.Kind() == reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	case t.Kind() == reflect.Pointer:
+		return "*" + typeName(t.Elem())
+	case t.Kind() == reflect.Map:
+		return "map[" + typeName(t.Key()) + "]" + typeName(t.Elem())
+	case t.Kind() == reflect.Interface && t.NumMethod() == 0:
+		return "any"
+	}
+
+	return t.String()
+}
@@ -0,0 +1,139 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/pagefaultgames/rogueserver/api/account"
+	"github.com/pagefaultgames/rogueserver/api/daily"
+	"github.com/pagefaultgames/rogueserver/api/savedata"
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+/*
+	Every endpoint is registered from the routes table below, which is also the source of the OpenAPI document.
+	Request and response fields hold a zero value of the type the handler decodes or encodes; their schemas are derived from it.
+*/
+
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+	summary string
+	auth    bool
+	query   []string
+
+	// textQuery are query parameters that take a string rather than an integer
+	textQuery []string
+
+	// unlimited routes are exempt from rate limits, e.g. for load balancer health checks
+	unlimited bool
+
+	// anyVersion routes are served regardless of the game version the client reports
+	anyVersion bool
+
+	form     any // form encoded request body
+	request  any // JSON request body, a oneOf if the handler decodes one of several types
+	response any // JSON response body, a oneOf if the handler encodes one of several types
+
+	// content type of a response that isn't JSON
+	contentType string
+}
+
+var routes = []route{
+	// v1
+
+	// account
+	{pattern: "GET /account/info", handler: handleAccountInfo, summary: "get account info", auth: true, response: account.InfoResponse{}},
+	{pattern: "POST /account/register", handler: handleAccountRegister, summary: "register account", form: account.GenericAuthRequest{}},
+	{pattern: "POST /account/login", handler: handleAccountLogin, summary: "log into account", form: account.GenericAuthRequest{}, response: account.LoginResponse{}},
+	{pattern: "POST /account/changepw", handler: handleAccountChangePW, summary: "change account password", auth: true, form: account.ChangePWRequest{}},
+	{pattern: "GET /account/logout", handler: handleAccountLogout, summary: "log out of account", auth: true},
+
+	// game
+	{pattern: "GET /game/titlestats", handler: handleGameTitleStats, summary: "get title screen stats", response: defs.TitleStats{}},
+	{pattern: "GET /game/classicsessioncount", handler: handleGameClassicSessionCount, summary: "get classic session count", contentType: "text/plain"},
+
+	// savedata
+	{pattern: "GET /savedata/get", handler: handleSaveDataGet, summary: "get system save data, or session save data of slot if datatype is 1", auth: true, query: []string{"datatype", "slot"}, response: oneOf{defs.SystemSaveData{}, defs.SessionSaveData{}}},
+	{pattern: "POST /savedata/update", handler: handleSaveDataUpdate, summary: "update system save data, or session save data of slot if datatype is 1", auth: true, query: []string{"datatype", "slot", "trainerId", "secretId"}, request: oneOf{defs.SystemSaveData{}, defs.SessionSaveData{}}},
+	{pattern: "GET /savedata/delete", handler: handleSaveDataDelete, summary: "delete save data", auth: true, query: []string{"datatype", "slot", "trainerId", "secretId"}},
+	{pattern: "POST /savedata/clear", handler: handleSaveDataClear, summary: "mark session save data as cleared and delete", auth: true, query: []string{"datatype", "slot", "trainerId", "secretId"}, request: defs.SessionSaveData{}, response: savedata.ClearResponse{}},
+
+	// daily
+	{pattern: "GET /daily/seed", handler: handleDailySeed, summary: "get daily run seed, of the default challenge unless challenge is given", textQuery: []string{"challenge"}, contentType: "application/octet-stream"},
+	{pattern: "GET /daily/rankings", handler: handleDailyRankings, summary: "get daily rankings, of the period containing date if given, after cursor if given", query: []string{"category", "page", "limit"}, textQuery: []string{"challenge", "date", "cursor"}, response: []defs.DailyRanking{}},
+	{pattern: "GET /daily/rankingpagecount", handler: handleDailyRankingPageCount, summary: "get daily ranking page count, of the period containing date if given", query: []string{"category", "limit"}, textQuery: []string{"challenge", "date"}, contentType: "text/plain"},
+
+	// v2
+
+	// account
+	{pattern: "GET /v2/account/info", handler: handleAccountInfo, summary: "get account info", auth: true, response: account.InfoResponse{}},
+	{pattern: "POST /v2/account/register", handler: handleV2AccountRegister, summary: "register account", request: account.GenericAuthRequest{}},
+	{pattern: "POST /v2/account/login", handler: handleV2AccountLogin, summary: "log into account", request: account.GenericAuthRequest{}, response: account.LoginResponse{}},
+	{pattern: "POST /v2/account/changepw", handler: handleV2AccountChangePW, summary: "change account password", auth: true, request: account.ChangePWRequest{}},
+	{pattern: "POST /v2/account/logout", handler: handleAccountLogout, summary: "log out of account", auth: true},
+
+	// game
+	{pattern: "GET /v2/game/titlestats", handler: handleGameTitleStats, summary: "get title screen stats", response: defs.TitleStats{}},
+	{pattern: "GET /v2/game/classicsessioncount", handler: handleV2GameClassicSessionCount, summary: "get classic session count", response: defs.ClassicSessionCount{}},
+
+	// savedata
+	{pattern: "GET /v2/savedata/system", handler: handleV2SystemGet, summary: "get system save data", auth: true, response: defs.SystemSaveData{}},
+	{pattern: "PUT /v2/savedata/system", handler: handleV2SystemUpdate, summary: "update system save data", auth: true, request: defs.SystemSaveData{}},
+	{pattern: "DELETE /v2/savedata/system", handler: handleV2SystemDelete, summary: "delete system save data", auth: true, request: savedata.TrainerIdsRequest{}},
+	{pattern: "GET /v2/savedata/session/{slot}", handler: handleV2SessionGet, summary: "get session save data", auth: true, response: defs.SessionSaveData{}},
+	{pattern: "PUT /v2/savedata/session/{slot}", handler: handleV2SessionUpdate, summary: "update session save data", auth: true, request: savedata.SessionRequest{}},
+	{pattern: "DELETE /v2/savedata/session/{slot}", handler: handleV2SessionDelete, summary: "delete session save data", auth: true, request: savedata.TrainerIdsRequest{}},
+	{pattern: "POST /v2/savedata/session/{slot}/clear", handler: handleV2SessionClear, summary: "mark session save data as cleared and delete", auth: true, request: savedata.SessionRequest{}, response: savedata.ClearResponse{}},
+
+	// history
+	{pattern: "GET /v2/history", handler: handleV2History, summary: "list your past runs, newest first", auth: true, query: []string{"page"}, response: []defs.SessionHistoryEntry{}},
+	{pattern: "GET /v2/history/{id}", handler: handleV2HistoryEntry, summary: "get one of your past runs", auth: true, response: defs.SessionHistoryEntry{}},
+
+	// daily
+	{pattern: "GET /v2/daily/seed", handler: handleV2DailySeed, summary: "get daily run seed and its challenge, of the default challenge unless challenge is given", textQuery: []string{"challenge"}, response: daily.SeedResponse{}},
+	{pattern: "GET /v2/daily/rankings", handler: handleDailyRankings, summary: "get daily rankings, of the period containing date if given, after cursor if given", query: []string{"category", "page", "limit"}, textQuery: []string{"challenge", "date", "cursor"}, response: []defs.DailyRanking{}},
+	{pattern: "GET /v2/daily/rankings/pagecount", handler: handleV2DailyRankingPageCount, summary: "get daily ranking page count, of the period containing date if given", query: []string{"category", "limit"}, textQuery: []string{"challenge", "date"}, response: daily.RankingPageCountResponse{}},
+	{pattern: "GET /v2/daily/rankings/me", handler: handleV2DailyRankingPosition, summary: "get your daily ranking and the rankings around it, of the period containing date if given", auth: true, query: []string{"category", "neighbours"}, textQuery: []string{"challenge", "date"}, response: defs.DailyRankingPosition{}},
+	{pattern: "GET /v2/daily/categories", handler: handleV2DailyCategories, summary: "list the ranking categories", response: []defs.DailyRankingCategory{}},
+	{pattern: "GET /v2/daily/challenges", handler: handleV2DailyChallenges, summary: "list the daily challenges", response: []defs.DailyChallenge{}},
+	{pattern: "GET /v2/daily/seeds", handler: handleV2DailySeeds, summary: "list past daily seeds with participant counts and winners, newest first", query: []string{"page"}, textQuery: []string{"challenge"}, response: []defs.DailySeed{}},
+	{pattern: "GET /v2/daily/commitments", handler: handleV2DailyCommitments, summary: "list the hashes of daily seeds published before their day, newest first, with the seeds of days that started", query: []string{"page"}, textQuery: []string{"challenge"}, response: []defs.DailySeedCommitment{}},
+
+	// events
+	{pattern: "GET /v2/events", handler: handleV2Events, summary: "list events, latest start first", query: []string{"page"}, response: []defs.Event{}},
+	{pattern: "GET /v2/events/{id}", handler: handleV2Event, summary: "get an event with the seed played now, if it is running", response: defs.Event{}},
+	{pattern: "GET /v2/events/{id}/rankings", handler: handleV2EventRankings, summary: "get event rankings by each player's best run, after cursor if given", query: []string{"page", "limit"}, textQuery: []string{"cursor"}, response: []defs.DailyRanking{}},
+
+	// moderation
+	{pattern: "GET /v2/moderation/savedata/findings", handler: handleV2SaveDataFindings, summary: "list save data validation findings, moderators only", auth: true, query: []string{"page"}, textQuery: []string{"username", "action"}, response: []defs.SaveDataFinding{}},
+	{pattern: "GET /v2/moderation/history", handler: handleV2ModerationHistory, summary: "list past runs played with a seed, moderators only", auth: true, query: []string{"page"}, textQuery: []string{"seed"}, response: []defs.SessionHistoryEntry{}},
+	{pattern: "GET /v2/moderation/daily/hidden", handler: handleV2HiddenDailyRuns, summary: "list daily runs hidden from rankings, moderators only", auth: true, query: []string{"page"}, response: []defs.HiddenDailyRun{}},
+	{pattern: "POST /v2/moderation/daily/review", handler: handleV2DailyRunReview, summary: "hide a daily run from rankings or show it, moderators only", auth: true, request: defs.DailyRunReview{}},
+	{pattern: "GET /v2/moderation/events", handler: handleV2ModerationEvents, summary: "list events with their seeds, moderators only", auth: true, query: []string{"page"}, response: []defs.Event{}},
+	{pattern: "POST /v2/moderation/events", handler: handleV2EventCreate, summary: "create an event, with a random seed if it has none, moderators only", auth: true, request: defs.Event{}, response: defs.Event{}},
+	{pattern: "PUT /v2/moderation/events/{id}", handler: handleV2EventUpdate, summary: "replace an event that wasn't rewarded yet, keeping its seeds if none are given, moderators only", auth: true, request: defs.Event{}},
+	{pattern: "DELETE /v2/moderation/events/{id}", handler: handleV2EventDelete, summary: "delete an event that hasn't started, moderators only", auth: true},
+
+	// meta
+	{pattern: "GET /healthz", handler: handleHealthz, summary: "check that the server is up", unlimited: true, anyVersion: true, contentType: "text/plain"},
+	{pattern: "GET /readyz", handler: handleReadyz, summary: "check that the server can serve requests", unlimited: true, anyVersion: true, response: defs.Readiness{}},
+	{pattern: "GET /version", handler: handleVersion, summary: "get build and protocol versions", anyVersion: true, response: defs.VersionInfo{}},
+	{pattern: "GET /openapi.json", handler: handleOpenAPI, summary: "get this OpenAPI document", anyVersion: true, contentType: "application/json"},
+}
@@ -0,0 +1,204 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/pagefaultgames/rogueserver/api/daily"
+	"github.com/pagefaultgames/rogueserver/api/event"
+	"github.com/pagefaultgames/rogueserver/api/savedata"
+	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+/*
+	The serve functions below are shared by the v1 and v2 savedata endpoints.
+	Callers are responsible for extracting the uuid, slot, trainer ids and save from the request.
+*/
+
+// v1 datatype values
+const (
+	datatypeSystem  = savedata.DatatypeSystem
+	datatypeSession = savedata.DatatypeSession
+)
+
+func serveSystemGet(w http.ResponseWriter, r *http.Request, uuid []byte) {
+	token, err := tokenFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	err = db.UpdateActiveSession(r.Context(), uuid, token)
+	if err != nil {
+		httpError(w, r, fmt.Errorf("failed to update active session: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	system, err := savedata.GetSystem(r.Context(), uuid)
+	if err != nil {
+		saveDataReadError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, system)
+}
+
+func serveSessionGet(w http.ResponseWriter, r *http.Request, uuid []byte, slot int) {
+	session, err := savedata.GetSession(r.Context(), uuid, slot)
+	if err != nil {
+		saveDataReadError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, session)
+}
+
+func serveSystemUpdate(w http.ResponseWriter, r *http.Request, uuid []byte, system defs.SystemSaveData) {
+	if !requireActiveSession(w, r) || !requireTrainerIds(w, r, uuid, system.TrainerId, system.SecretId) {
+		return
+	}
+
+	err := savedata.UpdateSystem(r.Context(), uuid, system)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func serveSessionUpdate(w http.ResponseWriter, r *http.Request, uuid []byte, slot, trainerId, secretId int, session defs.SessionSaveData) {
+	if !requireActiveSession(w, r) || !requireTrainerIds(w, r, uuid, trainerId, secretId) {
+		return
+	}
+
+	err := savedata.UpdateSession(r.Context(), uuid, slot, session)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func serveSystemDelete(w http.ResponseWriter, r *http.Request, uuid []byte, trainerId, secretId int) {
+	if !requireActiveSession(w, r) || !requireTrainerIds(w, r, uuid, trainerId, secretId) {
+		return
+	}
+
+	err := savedata.DeleteSystem(r.Context(), uuid)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func serveSessionDelete(w http.ResponseWriter, r *http.Request, uuid []byte, slot, trainerId, secretId int) {
+	if !requireActiveSession(w, r) || !requireTrainerIds(w, r, uuid, trainerId, secretId) {
+		return
+	}
+
+	err := savedata.DeleteSession(r.Context(), uuid, slot)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func serveSessionClear(w http.ResponseWriter, r *http.Request, uuid []byte, slot, trainerId, secretId int, session defs.SessionSaveData) {
+	active, err := isActiveSessionFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if !requireTrainerIds(w, r, uuid, trainerId, secretId) {
+		return
+	}
+
+	if !active {
+		// TODO: make this not suck
+		writeJSON(w, r, savedata.ClearResponse{Error: "session out of date"})
+		return
+	}
+
+	challenge, err := daily.TodaysChallenge(r.Context(), session.Seed)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if challenge == nil {
+		challenge = event.ActiveChallenge(session.Seed)
+	}
+
+	response, err := savedata.Clear(r.Context(), uuid, slot, challenge, session)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, response)
+}
+
+func requireActiveSession(w http.ResponseWriter, r *http.Request) bool {
+	active, err := isActiveSessionFromRequest(r)
+	if err != nil {
+		httpError(w, r, err, http.StatusBadRequest)
+		return false
+	}
+
+	if !active {
+		httpError(w, r, fmt.Errorf("session out of date"), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func requireTrainerIds(w http.ResponseWriter, r *http.Request, uuid []byte, trainerId, secretId int) bool {
+	valid, err := validateTrainerIds(r.Context(), uuid, trainerId, secretId)
+	if err != nil {
+		httpError(w, r, err, http.StatusInternalServerError)
+		return false
+	}
+
+	if !valid {
+		httpError(w, r, fmt.Errorf("session out of date"), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func saveDataReadError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	httpError(w, r, err, http.StatusInternalServerError)
+}
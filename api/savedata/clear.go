@@ -18,10 +18,17 @@
 package savedata
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/pagefaultgames/rogueserver/api/daily"
+	"github.com/pagefaultgames/rogueserver/api/event"
 	"github.com/pagefaultgames/rogueserver/db"
 	"github.com/pagefaultgames/rogueserver/defs"
-	"log"
+	"github.com/pagefaultgames/rogueserver/gameversion"
+	"github.com/pagefaultgames/rogueserver/metrics"
 )
 
 type ClearResponse struct {
@@ -29,42 +36,91 @@ type ClearResponse struct {
 	Error   string `json:"error"`
 }
 
-// /savedata/clear - mark session save data as cleared and delete
-func Clear(uuid []byte, slot int, seed string, save defs.SessionSaveData) (ClearResponse, error) {
+// /savedata/clear - mark session save data as cleared and delete, challenge is the daily challenge or event the save's seed is the current seed of, if any
+func Clear(ctx context.Context, uuid []byte, slot int, challenge *defs.DailyChallenge, save defs.SessionSaveData) (ClearResponse, error) {
 	var response ClearResponse
-	err := db.UpdateAccountLastActivity(uuid)
+	err := db.UpdateAccountLastActivity(ctx, uuid)
 	if err != nil {
-		log.Print("failed to update account last activity")
+		slog.WarnContext(ctx, "failed to update account last activity", "error", err)
 	}
 
 	if slot < 0 || slot >= defs.SessionSlotCount {
 		return response, fmt.Errorf("slot id %d out of range", slot)
 	}
 
-	sessionCompleted := validateSessionCompleted(save)
+	err = gameversion.Check(save.GameVersion)
+	if err != nil {
+		return response, err
+	}
+
+	previous := storedSession(ctx, uuid, slot)
+
+	err = validateSession(&save, previous).record(ctx, uuid, DatatypeSession, slot)
+	if err != nil {
+		return response, err
+	}
+
+	ranked := challenge != nil && int(save.GameMode) == challenge.GameMode
+	if !ranked {
+		challenge = nil
+	}
+
+	sessionCompleted := validateSessionCompleted(save, challenge)
+
+	if ranked {
+		verification := verifyDailyClear(ctx, uuid, &save)
+
+		err = verification.record(ctx, uuid, DatatypeSession, slot)
+		if err != nil {
+			return response, err
+		}
+
+		// corrections to the wave may change whether the run was completed
+		sessionCompleted = validateSessionCompleted(save, challenge)
 
-	if save.GameMode == 3 && save.Seed == seed {
 		waveCompleted := save.WaveIndex
 		if !sessionCompleted {
 			waveCompleted--
 		}
 
-		err = db.AddOrUpdateAccountDailyRun(uuid, save.Score, waveCompleted)
+		err = db.AddOrUpdateAccountDailyRun(ctx, uuid, challenge.Id, save.Score, waveCompleted, verification.flagged())
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to add or update daily run record", "error", err)
+		} else {
+			err = daily.RecordRun(ctx, uuid, challenge.Id)
+			if err == nil {
+				err = event.RecordRun(ctx, uuid, challenge.Id)
+			}
+			if err != nil {
+				slog.WarnContext(ctx, "failed to update cached leaderboards", "error", err)
+			}
+		}
+
+		err = db.DeleteDailyRunProgress(ctx, uuid, save.Seed)
 		if err != nil {
-			log.Printf("failed to add or update daily run record: %s", err)
+			slog.WarnContext(ctx, "failed to delete daily run progress", "error", err)
 		}
+
+		metrics.DailyClears.WithLabelValues(strconv.FormatBool(sessionCompleted)).Inc()
 	}
 
 	if sessionCompleted {
-		response.Success, err = db.TryAddDailyRunCompletion(uuid, save.Seed, int(save.GameMode))
+		response.Success, err = db.TryAddDailyRunCompletion(ctx, uuid, save.Seed, int(save.GameMode))
 		if err != nil {
-			log.Printf("failed to mark seed as completed: %s", err)
+			slog.ErrorContext(ctx, "failed to mark seed as completed", "error", err)
 		}
 	}
 
-	err = db.DeleteSessionSaveData(uuid, slot)
+	result := defs.SessionHistoryResultLoss
+	if sessionCompleted {
+		result = defs.SessionHistoryResultWin
+	}
+
+	recordHistory(ctx, uuid, save, result)
+
+	err = db.DeleteSessionSaveData(ctx, uuid, slot)
 	if err != nil {
-		log.Printf("failed to delete session save data: %s", err)
+		slog.ErrorContext(ctx, "failed to delete session save data", "error", err)
 	}
 
 	return response, nil
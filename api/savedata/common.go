@@ -18,15 +18,49 @@
 package savedata
 
 import (
+	"github.com/pagefaultgames/rogueserver/api/daily"
 	"github.com/pagefaultgames/rogueserver/defs"
 )
 
-func validateSessionCompleted(session defs.SessionSaveData) bool {
-	switch session.GameMode {
-	case 0:
-		return session.BattleType == 2 && session.WaveIndex == 200
-	case 3:
-		return session.BattleType == 2 && session.WaveIndex == 50
+// datatype values of v1 requests, also used to tell saves apart in validation findings
+const (
+	DatatypeSystem  = 0
+	DatatypeSession = 1
+)
+
+// ClassicWaveCount is the wave a classic session has to beat for it to count as completed, daily challenges have their own
+var ClassicWaveCount = 200
+
+// TrainerIdsRequest is the body of v2 requests that modify save data without carrying a system save
+type TrainerIdsRequest struct {
+	TrainerId int `json:"trainerId"`
+	SecretId  int `json:"secretId"`
+}
+
+// SessionRequest is the body of v2 requests that carry a session save
+type SessionRequest struct {
+	TrainerId int                  `json:"trainerId"`
+	SecretId  int                  `json:"secretId"`
+	Session   defs.SessionSaveData `json:"session"`
+}
+
+// validateSessionCompleted reports whether session was completed, as a run of challenge if that isn't nil.
+// Daily runs of past seeds are checked against the default challenge.
+func validateSessionCompleted(session defs.SessionSaveData, challenge *defs.DailyChallenge) bool {
+	if session.BattleType != 2 {
+		return false
+	}
+
+	if challenge != nil {
+		return session.WaveIndex == challenge.Waves
+	}
+
+	if session.GameMode == 0 {
+		return session.WaveIndex == ClassicWaveCount
+	}
+
+	if int(session.GameMode) == daily.DefaultChallenge().GameMode {
+		return session.WaveIndex == daily.DefaultChallenge().Waves
 	}
 
 	return false
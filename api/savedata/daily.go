@@ -0,0 +1,138 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package savedata
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pagefaultgames/rogueserver/api/daily"
+	"github.com/pagefaultgames/rogueserver/api/event"
+	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+/*
+	Daily runs are ranked by what the client reports when clearing them, so the server follows each run
+	through its session updates and checks the clear against that history. Clears that contradict it
+	break the dailyprogress rule, runs with a thin or odd history break dailyhistory and are hidden
+	from rankings until a moderator reviews them.
+*/
+
+var (
+	// DailyWaveSlack is how many waves a clear may be ahead of the last session update of its run
+	DailyWaveSlack = 1
+
+	// DailyMinUpdatesPerWave is the share of waves a run needs session updates for
+	DailyMinUpdatesPerWave = 0.5
+
+	// DailyMaxScorePerWave is the most score a run may gain per wave, 0 doesn't limit it.
+	// The default is well above what a run gains from the strongest bosses of a wave.
+	DailyMaxScorePerWave = 10000
+
+	// DailyPlayTimeSlack is how far a run's play time may be ahead of the real time since its first session update
+	DailyPlayTimeSlack = 5 * time.Minute
+)
+
+// trackDailyProgress records a session update of a daily or event run, flagging the run if it went backwards
+func trackDailyProgress(ctx context.Context, uuid []byte, save defs.SessionSaveData) {
+	if !daily.IsChallengeMode(int(save.GameMode)) && !event.IsEventMode(int(save.GameMode)) {
+		return
+	}
+
+	var flag string
+
+	progress, err := db.FetchDailyRunProgress(ctx, uuid, save.Seed)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// the first update is measured from the start of the run
+		if DailyMaxScorePerWave > 0 && save.Score > DailyMaxScorePerWave*max(1, save.WaveIndex) {
+			flag = fmt.Sprintf("score %d at wave %d in the first update", save.Score, save.WaveIndex)
+		}
+	case err != nil:
+		slog.WarnContext(ctx, "failed to read daily run progress", "error", err)
+		return
+	case save.WaveIndex < progress.Wave:
+		flag = fmt.Sprintf("wave went down from %d to %d", progress.Wave, save.WaveIndex)
+	case save.Score < progress.Score:
+		flag = fmt.Sprintf("score went down from %d to %d", progress.Score, save.Score)
+	case DailyMaxScorePerWave > 0 && save.Score-progress.Score > DailyMaxScorePerWave*max(1, save.WaveIndex-progress.Wave):
+		flag = fmt.Sprintf("score went up by %d from wave %d to %d", save.Score-progress.Score, progress.Wave, save.WaveIndex)
+	}
+
+	err = db.UpdateDailyRunProgress(ctx, uuid, save.Seed, save.WaveIndex, save.Score, save.Money, save.PlayTime, flag)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to update daily run progress", "error", err)
+	}
+}
+
+// verifyDailyClear checks the final state of a daily run against the progress recorded for it
+func verifyDailyClear(ctx context.Context, uuid []byte, save *defs.SessionSaveData) *validation {
+	v := &validation{}
+
+	progress, err := db.FetchDailyRunProgress(ctx, uuid, save.Seed)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.WarnContext(ctx, "failed to read daily run progress", "error", err)
+		}
+
+		v.report("dailyhistory", "seed", "no session updates recorded for the run", nil)
+		return v
+	}
+
+	if save.WaveIndex < progress.Wave {
+		v.report("dailyprogress", "waveIndex", fmt.Sprintf("%d is below the recorded wave %d", save.WaveIndex, progress.Wave), func() { save.WaveIndex = progress.Wave })
+	}
+
+	if save.WaveIndex > progress.Wave+DailyWaveSlack {
+		v.report("dailyprogress", "waveIndex", fmt.Sprintf("%d is too far ahead of the recorded wave %d", save.WaveIndex, progress.Wave), func() { save.WaveIndex = progress.Wave + DailyWaveSlack })
+	}
+
+	if save.Score < progress.Score {
+		v.report("dailyprogress", "score", fmt.Sprintf("%d is below the recorded score %d", save.Score, progress.Score), func() { save.Score = progress.Score })
+	}
+
+	if DailyMaxScorePerWave > 0 {
+		limit := progress.Score + DailyMaxScorePerWave*max(1, save.WaveIndex-progress.Wave)
+		if save.Score > limit {
+			v.report("dailyprogress", "score", fmt.Sprintf("%d is too far ahead of the recorded score %d", save.Score, progress.Score), func() { save.Score = limit })
+		}
+	}
+
+	if save.PlayTime < progress.PlayTime {
+		v.report("dailyprogress", "playTime", fmt.Sprintf("%d is below the recorded play time %d", save.PlayTime, progress.PlayTime), nil)
+	}
+
+	if progress.Flag != "" {
+		v.report("dailyhistory", "seed", progress.Flag, nil)
+	}
+
+	if float64(progress.Updates) < float64(save.WaveIndex)*DailyMinUpdatesPerWave {
+		v.report("dailyhistory", "seed", fmt.Sprintf("only %d session updates for %d waves", progress.Updates, save.WaveIndex), nil)
+	}
+
+	if save.PlayTime > progress.Elapsed+int(DailyPlayTimeSlack.Seconds()) {
+		v.report("dailyhistory", "playTime", fmt.Sprintf("%ds is longer than the %ds since the run started", save.PlayTime, progress.Elapsed), nil)
+	}
+
+	return v
+}
@@ -18,29 +18,46 @@
 package savedata
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+
 	"github.com/pagefaultgames/rogueserver/db"
 	"github.com/pagefaultgames/rogueserver/defs"
-	"log"
 )
 
-// /savedata/delete - delete save data
-func Delete(uuid []byte, datatype, slot int) error {
-	err := db.UpdateAccountLastActivity(uuid)
+// /savedata/delete?datatype=0, /v2/savedata/system - delete system save data
+func DeleteSystem(ctx context.Context, uuid []byte) error {
+	err := db.UpdateAccountLastActivity(ctx, uuid)
 	if err != nil {
-		log.Print("failed to update account last activity")
+		slog.WarnContext(ctx, "failed to update account last activity", "error", err)
 	}
 
-	switch datatype {
-	case 0: // System
-		return db.DeleteSystemSaveData(uuid)
-	case 1: // Session
-		if slot < 0 || slot >= defs.SessionSlotCount {
-			return fmt.Errorf("slot id %d out of range", slot)
-		}
-
-		return db.DeleteSessionSaveData(uuid, slot)
-	default:
-		return fmt.Errorf("invalid data type")
+	return db.DeleteSystemSaveData(ctx, uuid)
+}
+
+// /savedata/delete?datatype=1, /v2/savedata/session/{slot} - delete session save data
+func DeleteSession(ctx context.Context, uuid []byte, slot int) error {
+	err := db.UpdateAccountLastActivity(ctx, uuid)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to update account last activity", "error", err)
 	}
+
+	if slot < 0 || slot >= defs.SessionSlotCount {
+		return fmt.Errorf("slot id %d out of range", slot)
+	}
+
+	// deleting a run that's still going abandons it
+	session := storedSession(ctx, uuid, slot)
+
+	err = db.DeleteSessionSaveData(ctx, uuid, slot)
+	if err != nil {
+		return err
+	}
+
+	if session != nil {
+		recordHistory(ctx, uuid, *session, defs.SessionHistoryResultAbandoned)
+	}
+
+	return nil
 }
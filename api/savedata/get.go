@@ -18,6 +18,7 @@
 package savedata
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 
@@ -25,41 +26,45 @@ import (
 	"github.com/pagefaultgames/rogueserver/defs"
 )
 
-// /savedata/get - get save data
-func Get(uuid []byte, datatype, slot int) (any, error) {
-	switch datatype {
-	case 0: // System
-		if slot != 0 {
-			return nil, fmt.Errorf("invalid slot id for system data")
-		}
+// /savedata/get?datatype=0, /v2/savedata/system - get system save data
+func GetSystem(ctx context.Context, uuid []byte) (defs.SystemSaveData, error) {
+	system, err := db.ReadSystemSaveData(ctx, uuid)
+	if err != nil {
+		return system, err
+	}
 
-		system, err := db.ReadSystemSaveData(uuid)
-		if err != nil {
-			return nil, err
-		}
+	err = migrateSystem(&system)
+	if err != nil {
+		return system, err
+	}
 
-		compensations, err := db.FetchAndClaimAccountCompensations(uuid)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch compensations: %s", err)
-		}
+	compensations, err := db.FetchAndClaimAccountCompensations(ctx, uuid)
+	if err != nil {
+		return system, fmt.Errorf("failed to fetch compensations: %w", err)
+	}
 
-		for compensationType, amount := range compensations {
-			system.VoucherCounts[strconv.Itoa(compensationType)] += amount
-		}
+	for compensationType, amount := range compensations {
+		system.VoucherCounts[strconv.Itoa(compensationType)] += amount
+	}
 
-		return system, nil
-	case 1: // Session
-		if slot < 0 || slot >= defs.SessionSlotCount {
-			return nil, fmt.Errorf("slot id %d out of range", slot)
-		}
+	return system, nil
+}
 
-		session, err := db.ReadSessionSaveData(uuid, slot)
-		if err != nil {
-			return nil, err
-		}
+// /savedata/get?datatype=1, /v2/savedata/session/{slot} - get session save data
+func GetSession(ctx context.Context, uuid []byte, slot int) (defs.SessionSaveData, error) {
+	if slot < 0 || slot >= defs.SessionSlotCount {
+		return defs.SessionSaveData{}, fmt.Errorf("slot id %d out of range", slot)
+	}
+
+	session, err := db.ReadSessionSaveData(ctx, uuid, slot)
+	if err != nil {
+		return session, err
+	}
 
-		return session, nil
-	default:
-		return nil, fmt.Errorf("invalid data type")
+	err = migrateSession(&session)
+	if err != nil {
+		return session, err
 	}
+
+	return session, nil
 }
@@ -0,0 +1,75 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package savedata
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+// /v2/history - list the runs of an account, newest first
+func History(ctx context.Context, uuid []byte, page int) ([]defs.SessionHistoryEntry, error) {
+	entries, err := db.FetchSessionHistory(ctx, uuid, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch run history: %w", err)
+	}
+
+	return entries, nil
+}
+
+// /v2/history/{id} - get a run of an account
+func HistoryEntry(ctx context.Context, uuid []byte, id int) (defs.SessionHistoryEntry, error) {
+	return db.FetchSessionHistoryEntry(ctx, uuid, id)
+}
+
+// /v2/moderation/history - list the runs played with a seed, newest first
+func HistoryBySeed(ctx context.Context, seed string, page int) ([]defs.SessionHistoryEntry, error) {
+	entries, err := db.FetchSessionHistoryBySeed(ctx, seed, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch run history: %w", err)
+	}
+
+	return entries, nil
+}
+
+// recordHistory adds a run that ended to the history of its account
+func recordHistory(ctx context.Context, uuid []byte, session defs.SessionSaveData, result defs.SessionHistoryResult) {
+	run := defs.SessionHistoryData{
+		Seed:        session.Seed,
+		PlayTime:    session.PlayTime,
+		Result:      result,
+		GameMode:    session.GameMode,
+		Party:       session.Party,
+		Modifiers:   session.Modifiers,
+		Money:       session.Money,
+		Score:       session.Score,
+		WaveIndex:   session.WaveIndex,
+		BattleType:  session.BattleType,
+		GameVersion: session.GameVersion,
+		Timestamp:   session.Timestamp,
+	}
+
+	err := db.AddSessionHistory(ctx, uuid, run)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to record run history", "error", err)
+	}
+}
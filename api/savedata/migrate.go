@@ -0,0 +1,132 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package savedata
+
+import (
+	"fmt"
+
+	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/gameversion"
+)
+
+// SystemMigration upgrades a system save made before Version to the shape clients of Version expect
+type SystemMigration struct {
+	Version string
+	Migrate func(save *defs.SystemSaveData) error
+}
+
+// SessionMigration upgrades a session save made before Version to the shape clients of Version expect
+type SessionMigration struct {
+	Version string
+	Migrate func(save *defs.SessionSaveData) error
+}
+
+// migrations are applied on read to saves older than their version, they must be kept in version order
+var (
+	SystemMigrations = []SystemMigration{
+		{Version: "1.0.4", Migrate: migrateStarterMoveData},
+	}
+
+	SessionMigrations = []SessionMigration{}
+)
+
+func migrateSystem(save *defs.SystemSaveData) error {
+	for _, migration := range SystemMigrations {
+		older, err := olderThan(save.GameVersion, migration.Version)
+		if err != nil {
+			return err
+		}
+
+		if !older {
+			continue
+		}
+
+		err = migration.Migrate(save)
+		if err != nil {
+			return fmt.Errorf("failed to migrate system save data to %s: %s", migration.Version, err)
+		}
+
+		save.GameVersion = migration.Version
+	}
+
+	return nil
+}
+
+func migrateSession(save *defs.SessionSaveData) error {
+	for _, migration := range SessionMigrations {
+		older, err := olderThan(save.GameVersion, migration.Version)
+		if err != nil {
+			return err
+		}
+
+		if !older {
+			continue
+		}
+
+		err = migration.Migrate(save)
+		if err != nil {
+			return fmt.Errorf("failed to migrate session save data to %s: %s", migration.Version, err)
+		}
+
+		save.GameVersion = migration.Version
+	}
+
+	return nil
+}
+
+// olderThan reports whether a save made with version predates target, saves without a version predate everything
+func olderThan(version, target string) (bool, error) {
+	if version == "" {
+		return true, nil
+	}
+
+	order, err := gameversion.Compare(version, target)
+	if err != nil {
+		return false, fmt.Errorf("unknown save version: %s", err)
+	}
+
+	return order < 0, nil
+}
+
+// migrateStarterMoveData moves the legacy per starter movesets and egg moves into the starter data
+func migrateStarterMoveData(save *defs.SystemSaveData) error {
+	if save.StarterData == nil {
+		save.StarterData = make(defs.StarterData)
+	}
+
+	for id, moveset := range save.StarterMoveData {
+		entry := save.StarterData[id]
+		if entry.Moveset.IsZero() {
+			entry.Moveset = moveset
+		}
+
+		save.StarterData[id] = entry
+	}
+
+	for id, eggMoves := range save.StarterEggMoveData {
+		entry := save.StarterData[id]
+		entry.EggMoves |= eggMoves
+
+		save.StarterData[id] = entry
+	}
+
+	save.StarterMoveData = nil
+	save.StarterEggMoveData = nil
+
+	return nil
+}
@@ -0,0 +1,228 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package savedata
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/gameversion"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the migration tests")
+
+// readSystem decodes a system save fixture the way the database hands it to GetSystem
+func readSystem(t *testing.T, path string) defs.SystemSaveData {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var save defs.SystemSaveData
+	err = json.Unmarshal(data, &save)
+	if err != nil {
+		t.Fatalf("failed to decode %s: %s", path, err)
+	}
+
+	return save
+}
+
+func encodeSystem(t *testing.T, save defs.SystemSaveData) []byte {
+	t.Helper()
+
+	data, err := json.MarshalIndent(save, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(data, '\n')
+}
+
+// TestSystemMigrationsGolden migrates every system save in testdata/migrate and compares it to its .golden file, run with -update to rewrite them
+func TestSystemMigrationsGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/migrate/system_*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inputs) == 0 {
+		t.Fatal("no system save fixtures")
+	}
+
+	for _, input := range inputs {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			save := readSystem(t, input)
+
+			err := migrateSystem(&save)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := encodeSystem(t, save)
+
+			golden := strings.TrimSuffix(input, ".json") + ".golden"
+			if *update {
+				err = os.WriteFile(golden, got, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("migrated save differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+// TestSystemMigrationsIdempotent checks that migrating a migrated save again, and running each migration twice, changes nothing
+func TestSystemMigrationsIdempotent(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/migrate/system_*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range inputs {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			save := readSystem(t, input)
+
+			err := migrateSystem(&save)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			once := encodeSystem(t, save)
+
+			err = migrateSystem(&save)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if twice := encodeSystem(t, save); !bytes.Equal(once, twice) {
+				t.Errorf("migrating again changed the save:\n%s", twice)
+			}
+
+			for _, migration := range SystemMigrations {
+				save := readSystem(t, input)
+
+				err = migration.Migrate(&save)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				once := encodeSystem(t, save)
+
+				err = migration.Migrate(&save)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if twice := encodeSystem(t, save); !bytes.Equal(once, twice) {
+					t.Errorf("migration to %s isn't idempotent:\n%s", migration.Version, twice)
+				}
+			}
+		})
+	}
+}
+
+// TestMigrationsInOrder checks that the registries are in version order and that migrateSystem applies exactly the newer ones, in order
+func TestMigrationsInOrder(t *testing.T) {
+	var versions []string
+	for _, migration := range SystemMigrations {
+		versions = append(versions, migration.Version)
+	}
+	for _, migration := range SessionMigrations {
+		versions = append(versions, migration.Version)
+	}
+
+	for i := 1; i < len(SystemMigrations); i++ {
+		order, err := gameversion.Compare(SystemMigrations[i-1].Version, SystemMigrations[i].Version)
+		if err != nil || order >= 0 {
+			t.Errorf("system migration to %s is registered after %s", SystemMigrations[i].Version, SystemMigrations[i-1].Version)
+		}
+	}
+
+	for i := 1; i < len(SessionMigrations); i++ {
+		order, err := gameversion.Compare(SessionMigrations[i-1].Version, SessionMigrations[i].Version)
+		if err != nil || order >= 0 {
+			t.Errorf("session migration to %s is registered after %s", SessionMigrations[i].Version, SessionMigrations[i-1].Version)
+		}
+	}
+
+	registered := SystemMigrations
+	defer func() { SystemMigrations = registered }()
+
+	var applied []string
+	record := func(version string) SystemMigration {
+		return SystemMigration{Version: version, Migrate: func(save *defs.SystemSaveData) error {
+			if save.GameVersion != "" {
+				order, err := gameversion.Compare(save.GameVersion, version)
+				if err != nil || order >= 0 {
+					t.Errorf("migration to %s ran on a save of %s", version, save.GameVersion)
+				}
+			}
+
+			applied = append(applied, version)
+			return nil
+		}}
+	}
+
+	SystemMigrations = []SystemMigration{record("1.0.2"), record("1.0.4"), record("1.1.0")}
+
+	for _, test := range []struct {
+		version string
+		want    []string
+	}{
+		{"", []string{"1.0.2", "1.0.4", "1.1.0"}},
+		{"1.0.0", []string{"1.0.2", "1.0.4", "1.1.0"}},
+		{"1.0.3", []string{"1.0.4", "1.1.0"}},
+		{"1.0.4", []string{"1.1.0"}},
+		{"1.1.0", nil},
+		{"1.2.0", nil},
+	} {
+		applied = nil
+		save := defs.SystemSaveData{GameVersion: test.version}
+
+		err := migrateSystem(&save)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(applied, test.want) {
+			t.Errorf("save of %q: applied %v, want %v", test.version, applied, test.want)
+		}
+
+		if len(test.want) > 0 && save.GameVersion != test.want[len(test.want)-1] {
+			t.Errorf("save of %q: version %q after migrating, want %q", test.version, save.GameVersion, test.want[len(test.want)-1])
+		}
+	}
+}
@@ -18,59 +18,88 @@
 package savedata
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"strconv"
+	"log/slog"
 
 	"github.com/klauspost/compress/zstd"
 	"github.com/pagefaultgames/rogueserver/db"
 	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/gameversion"
 )
 
 var zstdEncoder, _ = zstd.NewWriter(nil)
 
-// /savedata/update - update save data
-func Update(uuid []byte, slot int, save any) error {
-	err := db.UpdateAccountLastActivity(uuid)
+// /savedata/update?datatype=0, /v2/savedata/system - update system save data
+func UpdateSystem(ctx context.Context, uuid []byte, save defs.SystemSaveData) error {
+	err := db.UpdateAccountLastActivity(ctx, uuid)
 	if err != nil {
-		log.Print("failed to update account last activity")
+		slog.WarnContext(ctx, "failed to update account last activity", "error", err)
 	}
 
-	switch save := save.(type) {
-	case defs.SystemSaveData: // System
-		if save.TrainerId == 0 && save.SecretId == 0 {
-			return fmt.Errorf("invalid system data")
-		}
+	if save.TrainerId == 0 && save.SecretId == 0 {
+		return fmt.Errorf("invalid system data")
+	}
+
+	err = gameversion.Check(save.GameVersion)
+	if err != nil {
+		return err
+	}
+
+	previous := storedSystem(ctx, uuid)
+
+	err = validateSystem(&save, previous).record(ctx, uuid, DatatypeSystem, 0)
+	if err != nil {
+		return err
+	}
+
+	err = db.UpdateAccountStats(ctx, uuid, save.GameStats, save.VoucherCounts)
+	if err != nil {
+		return fmt.Errorf("failed to update account stats: %w", err)
+	}
+
+	err = db.DeleteClaimedAccountCompensations(ctx, uuid)
+	if err != nil {
+		return fmt.Errorf("failed to delete claimed compensations: %w", err)
+	}
 
-		if save.GameVersion != "1.0.4" {
-			return fmt.Errorf("client version out of date")
-		}
+	return db.StoreSystemSaveData(ctx, uuid, save)
+}
 
-		err = db.UpdateAccountStats(uuid, save.GameStats, save.VoucherCounts)
-		if err != nil {
-			return fmt.Errorf("failed to update account stats: %s", err)
-		}
+// /savedata/update?datatype=1, /v2/savedata/session/{slot} - update session save data
+func UpdateSession(ctx context.Context, uuid []byte, slot int, save defs.SessionSaveData) error {
+	err := db.UpdateAccountLastActivity(ctx, uuid)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to update account last activity", "error", err)
+	}
 
-		err = db.DeleteClaimedAccountCompensations(uuid)
-		if err != nil {
-			return fmt.Errorf("failed to delete claimed compensations: %s", err)
-		}
+	if slot < 0 || slot >= defs.SessionSlotCount {
+		return fmt.Errorf("slot id %d out of range", slot)
+	}
 
-		return db.StoreSystemSaveData(uuid, save)
+	err = gameversion.Check(save.GameVersion)
+	if err != nil {
+		return err
+	}
 
-	case defs.SessionSaveData: // Session
-		if slot < 0 || slot >= defs.SessionSlotCount {
-			return fmt.Errorf("slot id %d out of range", slot)
-		}
+	previous := storedSession(ctx, uuid, slot)
 
-		filename := "session"
-		if slot != 0 {
-			filename += strconv.Itoa(slot)
-		}
+	err = validateSession(&save, previous).record(ctx, uuid, DatatypeSession, slot)
+	if err != nil {
+		return err
+	}
 
-		return db.StoreSessionSaveData(uuid, save, slot)
+	err = db.StoreSessionSaveData(ctx, uuid, save, slot)
+	if err != nil {
+		return err
+	}
 
-	default:
-		return fmt.Errorf("invalid data type")
+	// starting a new run in a slot abandons the one it replaces
+	if previous != nil && previous.Seed != save.Seed {
+		recordHistory(ctx, uuid, *previous, defs.SessionHistoryResultAbandoned)
 	}
+
+	trackDailyProgress(ctx, uuid, save)
+
+	return nil
 }
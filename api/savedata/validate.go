@@ -0,0 +1,333 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package savedata
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+// Action is what happens to a save that breaks a rule
+type Action string
+
+const (
+	ActionOff    Action = "off"    // the rule isn't checked
+	ActionClamp  Action = "clamp"  // the value is corrected and the save stored
+	ActionFlag   Action = "flag"   // the save is stored as is, for a moderator to review
+	ActionReject Action = "reject" // the save isn't stored
+)
+
+type Rule struct {
+	Action Action
+
+	// Limit is the bound checked by rules that have one
+	Limit int
+}
+
+// Rules are checked against every incoming save, by name. ParseRules overrides them.
+var Rules = map[string]Rule{
+	"ivs":           {Action: ActionClamp, Limit: 31},   // pokemon ivs in the dex and party are within 0 and Limit
+	"candycount":    {Action: ActionClamp, Limit: 9999}, // starter candy counts are within 0 and Limit
+	"gamestats":     {Action: ActionClamp},              // game stats aren't negative
+	"vouchers":      {Action: ActionClamp},              // voucher counts aren't negative
+	"statsdecrease": {Action: ActionFlag},               // game stats don't go down from the stored save
+	"money":         {Action: ActionReject},             // session money isn't negative
+	"score":         {Action: ActionReject},             // session score isn't negative
+	"level":         {Action: ActionFlag, Limit: 10000}, // party levels are within 1 and Limit
+	"wavebackward":  {Action: ActionFlag},               // a session's wave doesn't go down from the stored save of the same run
+	"dailyprogress": {Action: ActionReject},             // a daily clear doesn't contradict what its run's session updates showed
+	"dailyhistory":  {Action: ActionFlag},               // a daily clear has a believable history of session updates, flagged runs are hidden from rankings
+}
+
+// ParseRules overrides Rules from "<rule>=<action>[/<limit>],..."
+func ParseRules(s string) error {
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, spec, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("invalid save data rule %q: missing =", item)
+		}
+
+		rule, ok := Rules[name]
+		if !ok {
+			return fmt.Errorf("invalid save data rule %q: unknown rule", item)
+		}
+
+		action, limit, hasLimit := strings.Cut(spec, "/")
+
+		rule.Action = Action(action)
+		switch rule.Action {
+		case ActionOff, ActionClamp, ActionFlag, ActionReject:
+		default:
+			return fmt.Errorf("invalid save data rule %q: action must be off, clamp, flag or reject", item)
+		}
+
+		if hasLimit {
+			var err error
+			rule.Limit, err = strconv.Atoi(limit)
+			if err != nil || rule.Limit < 0 {
+				return fmt.Errorf("invalid save data rule %q: invalid limit", item)
+			}
+		}
+
+		Rules[name] = rule
+	}
+
+	return nil
+}
+
+// ValidationError is returned for saves that broke a rule with the reject action
+type ValidationError struct {
+	Findings []defs.SaveDataFinding
+}
+
+func (e *ValidationError) Error() string {
+	var messages []string
+	for _, finding := range e.Findings {
+		if Action(finding.Action) == ActionReject {
+			messages = append(messages, finding.Field+": "+finding.Message)
+		}
+	}
+
+	return "invalid save data: " + strings.Join(messages, ", ")
+}
+
+type validation struct {
+	findings []defs.SaveDataFinding
+}
+
+// report records that rule was broken, clamp corrects the value if that is the rule's action.
+// Values that can't be corrected have a nil clamp and are flagged instead.
+func (v *validation) report(rule, field, message string, clamp func()) {
+	action := Rules[rule].Action
+	if action == ActionOff || action == "" {
+		return
+	}
+
+	if action == ActionClamp {
+		if clamp == nil {
+			action = ActionFlag
+		} else {
+			clamp()
+		}
+	}
+
+	v.findings = append(v.findings, defs.SaveDataFinding{Rule: rule, Action: string(action), Field: field, Message: message})
+}
+
+// bound reports value if it's outside of low and high under rule, clamping it into the range
+func (v *validation) bound(rule, field string, value *int, low, high int) {
+	switch {
+	case *value < low:
+		v.report(rule, field, fmt.Sprintf("%d is below %d", *value, low), func() { *value = low })
+	case *value > high:
+		v.report(rule, field, fmt.Sprintf("%d is above %d", *value, high), func() { *value = high })
+	}
+}
+
+// flagged joins the messages of findings with the flag action, empty if there are none
+func (v *validation) flagged() string {
+	var messages []string
+	for _, finding := range v.findings {
+		if Action(finding.Action) == ActionFlag {
+			messages = append(messages, finding.Field+": "+finding.Message)
+		}
+	}
+
+	return strings.Join(messages, ", ")
+}
+
+// record stores the findings for moderators and returns a *ValidationError if the save has to be rejected
+func (v *validation) record(ctx context.Context, uuid []byte, datatype, slot int) error {
+	if len(v.findings) == 0 {
+		return nil
+	}
+
+	err := db.AddSaveDataFindings(ctx, uuid, datatype, slot, v.findings)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to record save data findings", "error", err)
+	}
+
+	for _, finding := range v.findings {
+		if Action(finding.Action) == ActionReject {
+			return &ValidationError{Findings: v.findings}
+		}
+	}
+
+	return nil
+}
+
+// validateSystem checks save against Rules and the previously stored save, which may be nil
+func validateSystem(save, previous *defs.SystemSaveData) *validation {
+	v := &validation{}
+
+	for id, entry := range save.DexData {
+		for i := range entry.Ivs {
+			v.bound("ivs", fmt.Sprintf("dexData.%d.ivs.%d", id, i), &entry.Ivs[i], 0, Rules["ivs"].Limit)
+		}
+	}
+
+	for id, entry := range save.StarterData {
+		v.bound("candycount", fmt.Sprintf("starterData.%d.candyCount", id), &entry.CandyCount, 0, Rules["candycount"].Limit)
+		save.StarterData[id] = entry
+	}
+
+	for name, count := range save.VoucherCounts {
+		if count < 0 {
+			v.report("vouchers", "voucherCounts."+name, fmt.Sprintf("%d is negative", count), func() { save.VoucherCounts[name] = 0 })
+		}
+	}
+
+	current := gameStats(&save.GameStats)
+	var stored map[string]*int
+	if previous != nil {
+		stored = gameStats(&previous.GameStats)
+	}
+
+	for name, value := range current {
+		// stats the client left out keep their stored value
+		if !save.GameStats.Has(name) {
+			if before, ok := stored[name]; ok {
+				*value = *before
+			}
+
+			continue
+		}
+
+		if *value < 0 {
+			v.report("gamestats", "gameStats."+name, fmt.Sprintf("%d is negative", *value), func() { *value = 0 })
+		}
+
+		if before, ok := stored[name]; ok && *value < *before {
+			v.report("statsdecrease", "gameStats."+name, fmt.Sprintf("went down from %d to %d", *before, *value), func() { *value = *before })
+		}
+	}
+
+	return v
+}
+
+// validateSession checks save against Rules and the previously stored save in the same slot, which may be nil
+func validateSession(save, previous *defs.SessionSaveData) *validation {
+	v := &validation{}
+
+	if save.Money < 0 {
+		v.report("money", "money", fmt.Sprintf("%d is negative", save.Money), func() { save.Money = 0 })
+	}
+
+	if save.Score < 0 {
+		v.report("score", "score", fmt.Sprintf("%d is negative", save.Score), func() { save.Score = 0 })
+	}
+
+	for i := range save.Party {
+		pokemon := &save.Party[i]
+
+		v.bound("level", fmt.Sprintf("party.%d.level", i), &pokemon.Level, 1, Rules["level"].Limit)
+
+		for j := range pokemon.Ivs {
+			v.bound("ivs", fmt.Sprintf("party.%d.ivs.%d", i, j), &pokemon.Ivs[j], 0, Rules["ivs"].Limit)
+		}
+	}
+
+	if previous != nil && previous.Seed == save.Seed && save.WaveIndex < previous.WaveIndex {
+		v.report("wavebackward", "waveIndex", fmt.Sprintf("went down from %d to %d", previous.WaveIndex, save.WaveIndex), func() { save.WaveIndex = previous.WaveIndex })
+	}
+
+	return v
+}
+
+// gameStats lists the counters in stats by their JSON name
+func gameStats(stats *defs.GameStats) map[string]*int {
+	return map[string]*int{
+		"playTime":                   &stats.PlayTime,
+		"battles":                    &stats.Battles,
+		"classicSessionsPlayed":      &stats.ClassicSessionsPlayed,
+		"sessionsWon":                &stats.SessionsWon,
+		"ribbonsOwned":               &stats.RibbonsOwned,
+		"dailyRunSessionsPlayed":     &stats.DailyRunSessionsPlayed,
+		"dailyRunSessionsWon":        &stats.DailyRunSessionsWon,
+		"endlessSessionsPlayed":      &stats.EndlessSessionsPlayed,
+		"highestEndlessWave":         &stats.HighestEndlessWave,
+		"highestLevel":               &stats.HighestLevel,
+		"highestMoney":               &stats.HighestMoney,
+		"highestDamage":              &stats.HighestDamage,
+		"highestHeal":                &stats.HighestHeal,
+		"pokemonSeen":                &stats.PokemonSeen,
+		"pokemonDefeated":            &stats.PokemonDefeated,
+		"pokemonCaught":              &stats.PokemonCaught,
+		"pokemonHatched":             &stats.PokemonHatched,
+		"subLegendaryPokemonSeen":    &stats.SubLegendaryPokemonSeen,
+		"subLegendaryPokemonCaught":  &stats.SubLegendaryPokemonCaught,
+		"subLegendaryPokemonHatched": &stats.SubLegendaryPokemonHatched,
+		"legendaryPokemonSeen":       &stats.LegendaryPokemonSeen,
+		"legendaryPokemonCaught":     &stats.LegendaryPokemonCaught,
+		"legendaryPokemonHatched":    &stats.LegendaryPokemonHatched,
+		"mythicalPokemonSeen":        &stats.MythicalPokemonSeen,
+		"mythicalPokemonCaught":      &stats.MythicalPokemonCaught,
+		"mythicalPokemonHatched":     &stats.MythicalPokemonHatched,
+		"shinyPokemonSeen":           &stats.ShinyPokemonSeen,
+		"shinyPokemonCaught":         &stats.ShinyPokemonCaught,
+		"shinyPokemonHatched":        &stats.ShinyPokemonHatched,
+		"pokemonFused":               &stats.PokemonFused,
+		"trainersDefeated":           &stats.TrainersDefeated,
+		"eggsPulled":                 &stats.EggsPulled,
+		"rareEggsPulled":             &stats.RareEggsPulled,
+		"epicEggsPulled":             &stats.EpicEggsPulled,
+		"legendaryEggsPulled":        &stats.LegendaryEggsPulled,
+		"manaphyEggsPulled":          &stats.ManaphyEggsPulled,
+	}
+}
+
+// storedSystem returns the stored system save to validate an update against, or nil if there is none or it can't be read
+func storedSystem(ctx context.Context, uuid []byte) *defs.SystemSaveData {
+	save, err := db.ReadSystemSaveData(ctx, uuid)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.WarnContext(ctx, "failed to read stored system save data to validate against", "error", err)
+		}
+
+		return nil
+	}
+
+	return &save
+}
+
+// storedSession returns the stored session save in slot to validate an update against, or nil if there is none or it can't be read
+func storedSession(ctx context.Context, uuid []byte, slot int) *defs.SessionSaveData {
+	save, err := db.ReadSessionSaveData(ctx, uuid, slot)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.WarnContext(ctx, "failed to read stored session save data to validate against", "error", err)
+		}
+
+		return nil
+	}
+
+	return &save
+}
@@ -0,0 +1,49 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package savedata
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+// TestValidateSystemPartialStats checks that stats missing from a save keep the value of the stored save
+func TestValidateSystemPartialStats(t *testing.T) {
+	var save, previous defs.SystemSaveData
+	err := json.Unmarshal([]byte(`{"gameStats": {"battles": 12}}`), &save)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal([]byte(`{"gameStats": {"battles": 10, "playTime": 3600, "pokemonCaught": 40}}`), &previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := validateSystem(&save, &previous)
+
+	if len(v.findings) != 0 {
+		t.Errorf("got findings %v, expected none", v.findings)
+	}
+
+	if save.GameStats.Battles != 12 || save.GameStats.PlayTime != 3600 || save.GameStats.PokemonCaught != 40 {
+		t.Errorf("got stats %+v", save.GameStats)
+	}
+}
@@ -18,25 +18,29 @@
 package api
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/metrics"
 	"github.com/robfig/cron/v3"
 )
 
+// stats are read by handlers while the scheduler updates them
 var (
 	scheduler           = cron.New(cron.WithLocation(time.UTC))
-	playerCount         int
-	battleCount         int
-	classicSessionCount int
+	playerCount         atomic.Int64
+	battleCount         atomic.Int64
+	classicSessionCount atomic.Int64
 )
 
 func scheduleStatRefresh() {
 	scheduler.AddFunc("@every 30s", func() {
 		err := updateStats()
 		if err != nil {
-			log.Printf("failed to update stats: %s", err)
+			slog.Error("failed to update stats", "error", err)
 		}
 	})
 
@@ -44,21 +48,29 @@ func scheduleStatRefresh() {
 }
 
 func updateStats() error {
-	var err error
-	playerCount, err = db.FetchPlayerCount()
+	players, err := db.FetchPlayerCount(context.Background())
 	if err != nil {
 		return err
 	}
 
-	battleCount, err = db.FetchBattleCount()
+	playerCount.Store(int64(players))
+	metrics.PlayerCount.Set(float64(players))
+
+	battles, err := db.FetchBattleCount(context.Background())
 	if err != nil {
 		return err
 	}
 
-	classicSessionCount, err = db.FetchClassicSessionCount()
+	battleCount.Store(int64(battles))
+	metrics.BattleCount.Set(float64(battles))
+
+	classicSessions, err := db.FetchClassicSessionCount(context.Background())
 	if err != nil {
 		return err
 	}
 
+	classicSessionCount.Store(int64(classicSessions))
+	metrics.ClassicSessionCount.Set(float64(classicSessions))
+
 	return nil
 }
@@ -0,0 +1,505 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package client is a typed client for the rogueserver v2 API, see /openapi.json for the wire format.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pagefaultgames/rogueserver/api/account"
+	"github.com/pagefaultgames/rogueserver/api/daily"
+	"github.com/pagefaultgames/rogueserver/api/savedata"
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Token is sent as the Authorization header, Login sets it and Logout clears it
+	Token string
+
+	// GameVersion is sent as the X-Game-Version header if set, servers reject requests without one unless configured otherwise
+	GameVersion string
+}
+
+// Error is returned for any non 200 response
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, HTTPClient: http.DefaultClient}
+}
+
+// account
+
+func (c *Client) Register(username, password string) error {
+	return c.do("POST", "/v2/account/register", nil, account.GenericAuthRequest{Username: username, Password: password}, nil)
+}
+
+func (c *Client) Login(username, password string) error {
+	var response account.LoginResponse
+	err := c.do("POST", "/v2/account/login", nil, account.GenericAuthRequest{Username: username, Password: password}, &response)
+	if err != nil {
+		return err
+	}
+
+	c.Token = response.Token
+
+	return nil
+}
+
+func (c *Client) Logout() error {
+	err := c.do("POST", "/v2/account/logout", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	c.Token = ""
+
+	return nil
+}
+
+func (c *Client) ChangePW(password string) error {
+	return c.do("POST", "/v2/account/changepw", nil, account.ChangePWRequest{Password: password}, nil)
+}
+
+func (c *Client) AccountInfo() (account.InfoResponse, error) {
+	var response account.InfoResponse
+	err := c.do("GET", "/v2/account/info", nil, nil, &response)
+
+	return response, err
+}
+
+// game
+
+func (c *Client) TitleStats() (defs.TitleStats, error) {
+	var response defs.TitleStats
+	err := c.do("GET", "/v2/game/titlestats", nil, nil, &response)
+
+	return response, err
+}
+
+func (c *Client) ClassicSessionCount() (int, error) {
+	var response defs.ClassicSessionCount
+	err := c.do("GET", "/v2/game/classicsessioncount", nil, nil, &response)
+
+	return response.ClassicSessionCount, err
+}
+
+// savedata
+
+func (c *Client) SystemSaveData() (defs.SystemSaveData, error) {
+	var response defs.SystemSaveData
+	err := c.do("GET", "/v2/savedata/system", nil, nil, &response)
+
+	return response, err
+}
+
+func (c *Client) UpdateSystemSaveData(system defs.SystemSaveData) error {
+	return c.do("PUT", "/v2/savedata/system", nil, system, nil)
+}
+
+func (c *Client) DeleteSystemSaveData(trainerId, secretId int) error {
+	return c.do("DELETE", "/v2/savedata/system", nil, savedata.TrainerIdsRequest{TrainerId: trainerId, SecretId: secretId}, nil)
+}
+
+func (c *Client) SessionSaveData(slot int) (defs.SessionSaveData, error) {
+	var response defs.SessionSaveData
+	err := c.do("GET", sessionPath(slot), nil, nil, &response)
+
+	return response, err
+}
+
+func (c *Client) UpdateSessionSaveData(slot, trainerId, secretId int, session defs.SessionSaveData) error {
+	return c.do("PUT", sessionPath(slot), nil, savedata.SessionRequest{TrainerId: trainerId, SecretId: secretId, Session: session}, nil)
+}
+
+func (c *Client) DeleteSessionSaveData(slot, trainerId, secretId int) error {
+	return c.do("DELETE", sessionPath(slot), nil, savedata.TrainerIdsRequest{TrainerId: trainerId, SecretId: secretId}, nil)
+}
+
+func (c *Client) ClearSessionSaveData(slot, trainerId, secretId int, session defs.SessionSaveData) (savedata.ClearResponse, error) {
+	var response savedata.ClearResponse
+	err := c.do("POST", sessionPath(slot)+"/clear", nil, savedata.SessionRequest{TrainerId: trainerId, SecretId: secretId, Session: session}, &response)
+
+	return response, err
+}
+
+// daily
+
+func (c *Client) DailySeed() (string, error) {
+	var response daily.SeedResponse
+	err := c.do("GET", "/v2/daily/seed", nil, nil, &response)
+
+	return response.Seed, err
+}
+
+// DailyChallengeSeed returns today's seed of challenge together with the challenge
+func (c *Client) DailyChallengeSeed(challenge string) (daily.SeedResponse, error) {
+	query := url.Values{}
+	query.Set("challenge", challenge)
+
+	var response daily.SeedResponse
+	err := c.do("GET", "/v2/daily/seed", query, nil, &response)
+
+	return response, err
+}
+
+// DailyChallenges lists the daily challenges
+func (c *Client) DailyChallenges() ([]defs.DailyChallenge, error) {
+	var response []defs.DailyChallenge
+	err := c.do("GET", "/v2/daily/challenges", nil, nil, &response)
+
+	return response, err
+}
+
+func (c *Client) DailyRankings(category, page int) ([]defs.DailyRanking, error) {
+	return c.DailyRankingsOn(category, "", page)
+}
+
+// DailyRankingsOn returns the rankings of the period containing date, formatted as YYYY-MM-DD, today if empty
+func (c *Client) DailyRankingsOn(category int, date string, page int) ([]defs.DailyRanking, error) {
+	query := url.Values{}
+	query.Set("category", strconv.Itoa(category))
+	query.Set("page", strconv.Itoa(page))
+	if date != "" {
+		query.Set("date", date)
+	}
+
+	var response []defs.DailyRanking
+	err := c.do("GET", "/v2/daily/rankings", query, nil, &response)
+
+	return response, err
+}
+
+// DailyRankingsAfter returns up to limit rankings of the period containing date, today if empty, after cursor, from the start if empty.
+// The cursor of the last ranking returned continues them.
+func (c *Client) DailyRankingsAfter(category int, date, cursor string, limit int) ([]defs.DailyRanking, error) {
+	return c.DailyChallengeRankingsAfter(defs.DefaultDailyChallenge, category, date, cursor, limit)
+}
+
+// DailyChallengeRankingsAfter is DailyRankingsAfter over the runs of challenge
+func (c *Client) DailyChallengeRankingsAfter(challenge string, category int, date, cursor string, limit int) ([]defs.DailyRanking, error) {
+	query := url.Values{}
+	query.Set("challenge", challenge)
+	query.Set("category", strconv.Itoa(category))
+	query.Set("limit", strconv.Itoa(limit))
+	if date != "" {
+		query.Set("date", date)
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	var response []defs.DailyRanking
+	err := c.do("GET", "/v2/daily/rankings", query, nil, &response)
+
+	return response, err
+}
+
+func (c *Client) DailyRankingPageCount(category int) (int, error) {
+	return c.DailyRankingPageCountOn(category, "")
+}
+
+// DailyRankingPageCountOn returns the page count of the rankings of the period containing date, today if empty
+func (c *Client) DailyRankingPageCountOn(category int, date string) (int, error) {
+	query := url.Values{}
+	query.Set("category", strconv.Itoa(category))
+	if date != "" {
+		query.Set("date", date)
+	}
+
+	var response daily.RankingPageCountResponse
+	err := c.do("GET", "/v2/daily/rankings/pagecount", query, nil, &response)
+
+	return response.PageCount, err
+}
+
+// DailyRankingPosition returns the logged in account's ranking in the period containing date, today if empty, with up to neighbours rankings above and below it
+func (c *Client) DailyRankingPosition(category int, date string, neighbours int) (defs.DailyRankingPosition, error) {
+	return c.DailyChallengeRankingPosition(defs.DefaultDailyChallenge, category, date, neighbours)
+}
+
+// DailyChallengeRankingPosition is DailyRankingPosition over the runs of challenge
+func (c *Client) DailyChallengeRankingPosition(challenge string, category int, date string, neighbours int) (defs.DailyRankingPosition, error) {
+	query := url.Values{}
+	query.Set("challenge", challenge)
+	query.Set("category", strconv.Itoa(category))
+	query.Set("neighbours", strconv.Itoa(neighbours))
+	if date != "" {
+		query.Set("date", date)
+	}
+
+	var response defs.DailyRankingPosition
+	err := c.do("GET", "/v2/daily/rankings/me", query, nil, &response)
+
+	return response, err
+}
+
+// DailyCategories lists the ranking categories
+func (c *Client) DailyCategories() ([]defs.DailyRankingCategory, error) {
+	var response []defs.DailyRankingCategory
+	err := c.do("GET", "/v2/daily/categories", nil, nil, &response)
+
+	return response, err
+}
+
+// DailySeeds lists past daily seeds with their participant counts and winners, newest first
+func (c *Client) DailySeeds(page int) ([]defs.DailySeed, error) {
+	return c.DailyChallengeSeeds(defs.DefaultDailyChallenge, page)
+}
+
+// DailyChallengeSeeds lists past seeds of challenge with their participant counts and winners, newest first
+func (c *Client) DailyChallengeSeeds(challenge string, page int) ([]defs.DailySeed, error) {
+	query := url.Values{}
+	query.Set("challenge", challenge)
+	query.Set("page", strconv.Itoa(page))
+
+	var response []defs.DailySeed
+	err := c.do("GET", "/v2/daily/seeds", query, nil, &response)
+
+	return response, err
+}
+
+// DailyCommitments lists the commitments to the seeds of challenge, newest first, with the seeds of days that started.
+// A seed matches its commitment if the hex encoded SHA-256 hash of the seed is the commitment.
+func (c *Client) DailyCommitments(challenge string, page int) ([]defs.DailySeedCommitment, error) {
+	query := url.Values{}
+	query.Set("challenge", challenge)
+	query.Set("page", strconv.Itoa(page))
+
+	var response []defs.DailySeedCommitment
+	err := c.do("GET", "/v2/daily/commitments", query, nil, &response)
+
+	return response, err
+}
+
+// history
+
+// History lists the runs of the logged in account, newest first
+func (c *Client) History(page int) ([]defs.SessionHistoryEntry, error) {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+
+	var response []defs.SessionHistoryEntry
+	err := c.do("GET", "/v2/history", query, nil, &response)
+
+	return response, err
+}
+
+func (c *Client) HistoryEntry(id int) (defs.SessionHistoryEntry, error) {
+	var response defs.SessionHistoryEntry
+	err := c.do("GET", "/v2/history/"+strconv.Itoa(id), nil, nil, &response)
+
+	return response, err
+}
+
+// events
+
+// Events lists events, latest start first
+func (c *Client) Events(page int) ([]defs.Event, error) {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+
+	var response []defs.Event
+	err := c.do("GET", "/v2/events", query, nil, &response)
+
+	return response, err
+}
+
+// Event returns an event with the seed played now, if it is running
+func (c *Client) Event(id int) (defs.Event, error) {
+	var response defs.Event
+	err := c.do("GET", eventPath(id), nil, nil, &response)
+
+	return response, err
+}
+
+// EventRankings returns up to limit rankings of an event after cursor, from the start if empty
+func (c *Client) EventRankings(id int, cursor string, limit int) ([]defs.DailyRanking, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	var response []defs.DailyRanking
+	err := c.do("GET", eventPath(id)+"/rankings", query, nil, &response)
+
+	return response, err
+}
+
+// moderation
+
+// HistoryBySeed lists the runs of any account played with seed, newest first
+func (c *Client) HistoryBySeed(seed string, page int) ([]defs.SessionHistoryEntry, error) {
+	query := url.Values{}
+	query.Set("seed", seed)
+	query.Set("page", strconv.Itoa(page))
+
+	var response []defs.SessionHistoryEntry
+	err := c.do("GET", "/v2/moderation/history", query, nil, &response)
+
+	return response, err
+}
+
+// SaveDataFindings lists save data validation findings, newest first. username and action may be empty to list all.
+func (c *Client) SaveDataFindings(username, action string, page int) ([]defs.SaveDataFinding, error) {
+	query := url.Values{}
+	if username != "" {
+		query.Set("username", username)
+	}
+	if action != "" {
+		query.Set("action", action)
+	}
+	query.Set("page", strconv.Itoa(page))
+
+	var response []defs.SaveDataFinding
+	err := c.do("GET", "/v2/moderation/savedata/findings", query, nil, &response)
+
+	return response, err
+}
+
+// HiddenDailyRuns lists daily runs hidden from rankings, newest first
+func (c *Client) HiddenDailyRuns(page int) ([]defs.HiddenDailyRun, error) {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+
+	var response []defs.HiddenDailyRun
+	err := c.do("GET", "/v2/moderation/daily/hidden", query, nil, &response)
+
+	return response, err
+}
+
+// ReviewDailyRun hides the daily run username made on date, formatted as 2006-01-02, from rankings or shows it
+func (c *Client) ReviewDailyRun(username, date string, hidden bool) error {
+	return c.do("POST", "/v2/moderation/daily/review", nil, defs.DailyRunReview{Username: username, Date: date, Hidden: hidden}, nil)
+}
+
+// ModerationEvents lists events with their seeds, latest start first
+func (c *Client) ModerationEvents(page int) ([]defs.Event, error) {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+
+	var response []defs.Event
+	err := c.do("GET", "/v2/moderation/events", query, nil, &response)
+
+	return response, err
+}
+
+// CreateEvent creates an event, with a random seed if it has none, and returns it with its id
+func (c *Client) CreateEvent(event defs.Event) (defs.Event, error) {
+	var response defs.Event
+	err := c.do("POST", "/v2/moderation/events", nil, event, &response)
+
+	return response, err
+}
+
+// UpdateEvent replaces the event with the id of event, keeping its seeds if event has none
+func (c *Client) UpdateEvent(event defs.Event) error {
+	return c.do("PUT", "/v2/moderation/events/"+strconv.Itoa(event.Id), nil, event, nil)
+}
+
+// DeleteEvent deletes an event that hasn't started
+func (c *Client) DeleteEvent(id int) error {
+	return c.do("DELETE", "/v2/moderation/events/"+strconv.Itoa(id), nil, nil, nil)
+}
+
+func eventPath(id int) string {
+	return "/v2/events/" + strconv.Itoa(id)
+}
+
+func sessionPath(slot int) string {
+	return "/v2/savedata/session/" + strconv.Itoa(slot)
+}
+
+// do sends a request with body encoded as JSON, if not nil, and decodes the JSON response into response, if not nil
+func (c *Client) do(method, path string, query url.Values, body, response any) error {
+	endpoint := c.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request json: %s", err)
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.Token != "" {
+		request.Header.Set("Authorization", c.Token)
+	}
+
+	if c.GameVersion != "" {
+		request.Header.Set("X-Game-Version", c.GameVersion)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return &Error{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(message))}
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(response)
+	if err != nil {
+		return fmt.Errorf("failed to decode response json: %s", err)
+	}
+
+	return nil
+}
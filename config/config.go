@@ -0,0 +1,215 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package config layers settings from a YAML file and environment variables under command line flags.
+//
+// Every flag is a setting: it can be given in the config file under the flag's name, or in the
+// environment as the flag's name in upper case after the prefix (e.g. ROGUESERVER_DBPASS).
+// Precedence is flags, then environment, then config file, then the flag's default.
+// Secrets can be read from a file by appending _file to the key or _FILE to the environment variable.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load defines a -config flag on fs, parses args and applies the config file and environment
+func Load(fs *flag.FlagSet, args []string, envPrefix string) error {
+	path := fs.String("config", "", "path to a YAML config file")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// remember flags given on the command line, they override everything else
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	if *path == "" {
+		*path = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	if *path != "" {
+		err = applyFile(fs, *path)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = applyEnv(fs, envPrefix)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range explicit {
+		fs.Set(name, value)
+	}
+
+	return nil
+}
+
+// Reread applies args, the config file and environment again to a copy of fs and returns the resulting
+// values of the named settings, leaving fs untouched. It's for settings that can change without a restart.
+func Reread(fs *flag.FlagSet, args []string, envPrefix string, names ...string) (map[string]string, error) {
+	scratch := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	scratch.SetOutput(io.Discard)
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		scratch.Var(&recorder{value: f.DefValue, isBool: ok && boolFlag.IsBoolFlag()}, f.Name, f.Usage)
+	})
+
+	err := Load(scratch, args, envPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		f := scratch.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown setting %q", name)
+		}
+
+		values[name] = f.Value.String()
+	}
+
+	return values, nil
+}
+
+// recorder is a flag value that keeps whatever it's set to, so settings can be reread without their real types
+type recorder struct {
+	value  string
+	isBool bool
+}
+
+func (r *recorder) String() string {
+	return r.value
+}
+
+func (r *recorder) Set(value string) error {
+	r.value = value
+	return nil
+}
+
+func (r *recorder) IsBoolFlag() bool {
+	return r.isBool
+}
+
+func applyFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %s", err)
+	}
+
+	var settings map[string]any
+	err = yaml.Unmarshal(data, &settings)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file: %s", err)
+	}
+
+	for key, value := range settings {
+		name, fromFile := strings.CutSuffix(key, "_file")
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("unknown setting %q in config file", key)
+		}
+
+		str := stringify(value)
+		if fromFile {
+			str, err = readSecret(str)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %s", key, err)
+			}
+		}
+
+		err = fs.Set(name, str)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s in config file: %s", key, err)
+		}
+	}
+
+	return nil
+}
+
+func applyEnv(fs *flag.FlagSet, envPrefix string) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+
+		variable := envPrefix + strings.ToUpper(f.Name)
+
+		value, ok := os.LookupEnv(variable)
+		if path, fromFile := os.LookupEnv(variable + "_FILE"); fromFile {
+			value, err = readSecret(path)
+			if err != nil {
+				err = fmt.Errorf("failed to read %s_FILE: %s", variable, err)
+				return
+			}
+
+			ok = true
+		}
+
+		if !ok {
+			return
+		}
+
+		err = fs.Set(f.Name, value)
+		if err != nil {
+			err = fmt.Errorf("invalid value for %s: %s", variable, err)
+		}
+	})
+
+	return err
+}
+
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// stringify converts a YAML value to the string a flag would be given, lists are comma separated
+func stringify(value any) string {
+	if list, ok := value.([]any); ok {
+		values := make([]string, len(list))
+		for i, v := range list {
+			values[i] = fmt.Sprint(v)
+		}
+
+		return strings.Join(values, ",")
+	}
+
+	return fmt.Sprint(value)
+}
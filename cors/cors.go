@@ -0,0 +1,125 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	DefaultMethods = []string{"OPTIONS", "GET", "POST", "PUT", "DELETE"}
+	DefaultHeaders = []string{"Authorization", "Content-Type", "X-Game-Version", "X-Request-ID"}
+)
+
+type Options struct {
+	// AllowedOrigins are exact origins ("https://pokerogue.net"), origins with a wildcard
+	// subdomain ("https://*.pokerogue.net") or "*" to allow any origin
+	AllowedOrigins []string
+
+	AllowedMethods []string
+	AllowedHeaders []string
+
+	// AllowCredentials lets allowed origins make requests with credentials, never combine it with "*"
+	AllowCredentials bool
+
+	// MaxAge is how long browsers may cache a preflight response, 0 leaves it up to the browser
+	MaxAge time.Duration
+}
+
+// Handler answers preflight requests and adds CORS headers to responses for allowed origins.
+// The matching origin is echoed back rather than "*" so credentials keep working.
+func Handler(options Options, next http.Handler) http.Handler {
+	if options.AllowedMethods == nil {
+		options.AllowedMethods = DefaultMethods
+	}
+
+	if options.AllowedHeaders == nil {
+		options.AllowedHeaders = DefaultHeaders
+	}
+
+	methods := strings.Join(options.AllowedMethods, ", ")
+	headers := strings.Join(options.AllowedHeaders, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the response depends on the origin whether or not it's allowed
+		w.Header().Add("Vary", "Origin")
+
+		preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin != "" && options.allowed(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+
+			if options.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+
+				if options.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(options.MaxAge.Seconds())))
+				}
+			}
+		}
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (options Options) allowed(origin string) bool {
+	origin = strings.ToLower(origin)
+
+	for _, allowed := range options.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+
+		prefix, suffix, wildcard := strings.Cut(allowed, "*")
+		if !wildcard || len(origin) <= len(prefix)+len(suffix) {
+			continue
+		}
+
+		if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+			continue
+		}
+
+		// the wildcard only stands for subdomains, not a path, port or userinfo
+		subdomain := origin[len(prefix) : len(origin)-len(suffix)]
+		if !strings.ContainsAny(subdomain, "/:@") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -18,15 +18,14 @@
 package db
 
 import (
-	"fmt"
-	"slices"
+	"context"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/pagefaultgames/rogueserver/defs"
 )
 
-func AddAccountRecord(uuid []byte, username string, key, salt []byte) error {
-	_, err := handle.Exec("INSERT INTO accounts (uuid, username, hash, salt, registered) VALUES (?, ?, ?, ?, UTC_TIMESTAMP())", uuid, username, key, salt)
+func AddAccountRecord(ctx context.Context, uuid []byte, username string, key, salt []byte) error {
+	_, err := exec(ctx, "INSERT INTO accounts (uuid, username, hash, salt, registered) VALUES (?, ?, ?, ?, UTC_TIMESTAMP())", uuid, username, key, salt)
 	if err != nil {
 		return err
 	}
@@ -34,18 +33,18 @@ func AddAccountRecord(uuid []byte, username string, key, salt []byte) error {
 	return nil
 }
 
-func AddAccountSession(username string, token []byte) error {
-	_, err := handle.Exec("INSERT INTO sessions (uuid, token, expire) SELECT a.uuid, ?, DATE_ADD(UTC_TIMESTAMP(), INTERVAL 1 WEEK) FROM accounts a WHERE a.username = ?", token, username)
+func AddAccountSession(ctx context.Context, username string, token []byte) error {
+	_, err := exec(ctx, "INSERT INTO sessions (uuid, token, expire) SELECT a.uuid, ?, DATE_ADD(UTC_TIMESTAMP(), INTERVAL 1 WEEK) FROM accounts a WHERE a.username = ?", token, username)
 	if err != nil {
 		return err
 	}
 
-	_, err = handle.Exec("UPDATE sessions s JOIN accounts a ON a.uuid = s.uuid SET s.active = 1 WHERE a.username = ? AND a.lastLoggedIn IS NULL", username)
+	_, err = exec(ctx, "UPDATE sessions s JOIN accounts a ON a.uuid = s.uuid SET s.active = 1 WHERE a.username = ? AND a.lastLoggedIn IS NULL", username)
 	if err != nil {
 		return err
 	}
 
-	_, err = handle.Exec("UPDATE accounts SET lastLoggedIn = UTC_TIMESTAMP() WHERE username = ?", username)
+	_, err = exec(ctx, "UPDATE accounts SET lastLoggedIn = UTC_TIMESTAMP() WHERE username = ?", username)
 	if err != nil {
 		return err
 	}
@@ -53,8 +52,8 @@ func AddAccountSession(username string, token []byte) error {
 	return nil
 }
 
-func UpdateAccountPassword(uuid, key, salt []byte) error {
-	_, err := handle.Exec("UPDATE accounts SET (hash, salt) VALUES (?, ?) WHERE uuid = ?", key, salt, uuid)
+func UpdateAccountPassword(ctx context.Context, uuid, key, salt []byte) error {
+	_, err := exec(ctx, "UPDATE accounts SET (hash, salt) VALUES (?, ?) WHERE uuid = ?", key, salt, uuid)
 	if err != nil {
 		return err
 	}
@@ -62,8 +61,8 @@ func UpdateAccountPassword(uuid, key, salt []byte) error {
 	return nil
 }
 
-func UpdateAccountLastActivity(uuid []byte) error {
-	_, err := handle.Exec("UPDATE accounts SET lastActivity = UTC_TIMESTAMP() WHERE uuid = ?", uuid)
+func UpdateAccountLastActivity(ctx context.Context, uuid []byte) error {
+	_, err := exec(ctx, "UPDATE accounts SET lastActivity = UTC_TIMESTAMP() WHERE uuid = ?", uuid)
 	if err != nil {
 		return err
 	}
@@ -71,26 +70,46 @@ func UpdateAccountLastActivity(uuid []byte) error {
 	return nil
 }
 
-func UpdateAccountStats(uuid []byte, stats defs.GameStats, voucherCounts map[string]int) error {
-	var columns = []string{"playTime", "battles", "classicSessionsPlayed", "sessionsWon", "highestEndlessWave", "highestLevel", "pokemonSeen", "pokemonDefeated", "pokemonCaught", "pokemonHatched", "eggsPulled", "regularVouchers", "plusVouchers", "premiumVouchers", "goldenVouchers"}
-
-	var statCols []string
-	var statValues []interface{}
+// UpdateAccountStats stores the stats that were sent in the save of uuid, leaving the others as they are
+func UpdateAccountStats(ctx context.Context, uuid []byte, stats defs.GameStats, voucherCounts map[string]int) error {
+	query, args := accountStatsQuery(uuid, stats, voucherCounts)
+	if query == "" {
+		return nil
+	}
 
-	m, ok := stats.(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("expected map[string]interface{}, got %T", stats)
+	_, err := exec(ctx, query, args...)
+	if err != nil {
+		return err
 	}
 
-	for k, v := range m {
-		value, ok := v.(float64)
-		if !ok {
-			return fmt.Errorf("expected float64, got %T", v)
-		}
+	return nil
+}
 
-		if slices.Contains(columns, k) {
-			statCols = append(statCols, k)
-			statValues = append(statValues, value)
+// accountStatsQuery builds the upsert of the stats and voucher counts that are set, an empty query if none are
+func accountStatsQuery(uuid []byte, stats defs.GameStats, voucherCounts map[string]int) (string, []interface{}) {
+	var statCols []string
+	var statValues []interface{}
+
+	for _, stat := range []struct {
+		name  string
+		value int
+	}{
+		{"playTime", stats.PlayTime},
+		{"battles", stats.Battles},
+		{"classicSessionsPlayed", stats.ClassicSessionsPlayed},
+		{"sessionsWon", stats.SessionsWon},
+		{"highestEndlessWave", stats.HighestEndlessWave},
+		{"highestLevel", stats.HighestLevel},
+		{"pokemonSeen", stats.PokemonSeen},
+		{"pokemonDefeated", stats.PokemonDefeated},
+		{"pokemonCaught", stats.PokemonCaught},
+		{"pokemonHatched", stats.PokemonHatched},
+		{"eggsPulled", stats.EggsPulled},
+	} {
+		// the columns are named like the stats
+		if stats.Has(stat.name) {
+			statCols = append(statCols, stat.name)
+			statValues = append(statValues, stat.value)
 		}
 	}
 
@@ -112,6 +131,10 @@ func UpdateAccountStats(uuid []byte, stats defs.GameStats, voucherCounts map[str
 		statValues = append(statValues, v)
 	}
 
+	if len(statCols) == 0 {
+		return "", nil
+	}
+
 	var statArgs []interface{}
 	statArgs = append(statArgs, uuid)
 	for range 2 {
@@ -140,18 +163,13 @@ func UpdateAccountStats(uuid []byte, stats defs.GameStats, voucherCounts map[str
 		query += col + " = ?"
 	}
 
-	_, err := handle.Exec(query, statArgs...)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return query, statArgs
 }
 
-func FetchAndClaimAccountCompensations(uuid []byte) (map[int]int, error) {
+func FetchAndClaimAccountCompensations(ctx context.Context, uuid []byte) (map[int]int, error) {
 	var compensations = make(map[int]int)
 
-	results, err := handle.Query("SELECT voucherType, count FROM accountCompensations WHERE uuid = ?", uuid)
+	results, err := queryRows(ctx, "SELECT voucherType, count FROM accountCompensations WHERE uuid = ?", uuid)
 	if err != nil {
 		return nil, err
 	}
@@ -168,7 +186,7 @@ func FetchAndClaimAccountCompensations(uuid []byte) (map[int]int, error) {
 		compensations[voucherType] = count
 	}
 
-	_, err = handle.Exec("UPDATE accountCompensations SET claimed = 1 WHERE uuid = ?", uuid)
+	_, err = exec(ctx, "UPDATE accountCompensations SET claimed = 1 WHERE uuid = ?", uuid)
 	if err != nil {
 		return compensations, err
 	}
@@ -176,8 +194,8 @@ func FetchAndClaimAccountCompensations(uuid []byte) (map[int]int, error) {
 	return compensations, nil
 }
 
-func DeleteClaimedAccountCompensations(uuid []byte) error {
-	_, err := handle.Exec("DELETE FROM accountCompensations WHERE uuid = ? AND claimed = 1", uuid)
+func DeleteClaimedAccountCompensations(ctx context.Context, uuid []byte) error {
+	_, err := exec(ctx, "DELETE FROM accountCompensations WHERE uuid = ? AND claimed = 1", uuid)
 	if err != nil {
 		return err
 	}
@@ -185,9 +203,9 @@ func DeleteClaimedAccountCompensations(uuid []byte) error {
 	return nil
 }
 
-func FetchAccountKeySaltFromUsername(username string) ([]byte, []byte, error) {
+func FetchAccountKeySaltFromUsername(ctx context.Context, username string) ([]byte, []byte, error) {
 	var key, salt []byte
-	err := handle.QueryRow("SELECT hash, salt FROM accounts WHERE username = ?", username).Scan(&key, &salt)
+	err := queryRow(ctx, "SELECT hash, salt FROM accounts WHERE username = ?", username).Scan(&key, &salt)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -195,8 +213,8 @@ func FetchAccountKeySaltFromUsername(username string) ([]byte, []byte, error) {
 	return key, salt, nil
 }
 
-func FetchTrainerIds(uuid []byte) (trainerId, secretId int, err error) {
-	err = handle.QueryRow("SELECT trainerId, secretId FROM accounts WHERE uuid = ?", uuid).Scan(&trainerId, &secretId)
+func FetchTrainerIds(ctx context.Context, uuid []byte) (trainerId, secretId int, err error) {
+	err = queryRow(ctx, "SELECT trainerId, secretId FROM accounts WHERE uuid = ?", uuid).Scan(&trainerId, &secretId)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -204,8 +222,8 @@ func FetchTrainerIds(uuid []byte) (trainerId, secretId int, err error) {
 	return trainerId, secretId, nil
 }
 
-func UpdateTrainerIds(trainerId, secretId int, uuid []byte) error {
-	_, err := handle.Exec("UPDATE accounts SET trainerId = ?, secretId = ? WHERE uuid = ?", trainerId, secretId, uuid)
+func UpdateTrainerIds(ctx context.Context, trainerId, secretId int, uuid []byte) error {
+	_, err := exec(ctx, "UPDATE accounts SET trainerId = ?, secretId = ? WHERE uuid = ?", trainerId, secretId, uuid)
 	if err != nil {
 		return err
 	}
@@ -213,9 +231,9 @@ func UpdateTrainerIds(trainerId, secretId int, uuid []byte) error {
 	return nil
 }
 
-func IsActiveSession(token []byte) (bool, error) {
+func IsActiveSession(ctx context.Context, token []byte) (bool, error) {
 	var active int
-	err := handle.QueryRow("SELECT `active` FROM sessions WHERE token = ?", token).Scan(&active)
+	err := queryRow(ctx, "SELECT `active` FROM sessions WHERE token = ?", token).Scan(&active)
 	if err != nil {
 		return false, err
 	}
@@ -223,8 +241,8 @@ func IsActiveSession(token []byte) (bool, error) {
 	return active == 1, nil
 }
 
-func UpdateActiveSession(uuid []byte, token []byte) error {
-	_, err := handle.Exec("UPDATE sessions SET `active` = CASE WHEN token = ? THEN 1 ELSE 0 END WHERE uuid = ?", token, uuid)
+func UpdateActiveSession(ctx context.Context, uuid []byte, token []byte) error {
+	_, err := exec(ctx, "UPDATE sessions SET `active` = CASE WHEN token = ? THEN 1 ELSE 0 END WHERE uuid = ?", token, uuid)
 	if err != nil {
 		return err
 	}
@@ -232,9 +250,9 @@ func UpdateActiveSession(uuid []byte, token []byte) error {
 	return nil
 }
 
-func FetchUUIDFromToken(token []byte) ([]byte, error) {
+func FetchUUIDFromToken(ctx context.Context, token []byte) ([]byte, error) {
 	var uuid []byte
-	err := handle.QueryRow("SELECT uuid FROM sessions WHERE token = ?", token).Scan(&uuid)
+	err := queryRow(ctx, "SELECT uuid FROM sessions WHERE token = ?", token).Scan(&uuid)
 	if err != nil {
 		return nil, err
 	}
@@ -242,8 +260,8 @@ func FetchUUIDFromToken(token []byte) ([]byte, error) {
 	return uuid, nil
 }
 
-func RemoveSessionFromToken(token []byte) error {
-	_, err := handle.Exec("DELETE FROM sessions WHERE token = ?", token)
+func RemoveSessionFromToken(ctx context.Context, token []byte) error {
+	_, err := exec(ctx, "DELETE FROM sessions WHERE token = ?", token)
 	if err != nil {
 		return err
 	}
@@ -251,9 +269,9 @@ func RemoveSessionFromToken(token []byte) error {
 	return nil
 }
 
-func FetchUsernameFromUUID(uuid []byte) (string, error) {
+func FetchUsernameFromUUID(ctx context.Context, uuid []byte) (string, error) {
 	var username string
-	err := handle.QueryRow("SELECT username FROM accounts WHERE uuid = ?", uuid).Scan(&username)
+	err := queryRow(ctx, "SELECT username FROM accounts WHERE uuid = ?", uuid).Scan(&username)
 	if err != nil {
 		return "", err
 	}
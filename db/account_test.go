@@ -0,0 +1,68 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+// TestAccountStatsQueryPartial checks that stats missing from a save aren't written, so they keep their stored value
+func TestAccountStatsQueryPartial(t *testing.T) {
+	var stats defs.GameStats
+	err := json.Unmarshal([]byte(`{"battles": 12, "eggsPulled": 3}`), &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuid := []byte("0123456789abcdef")
+
+	query, args := accountStatsQuery(uuid, stats, nil)
+
+	expected := "INSERT INTO accountStats (uuid, battles, eggsPulled) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE battles = ?, eggsPulled = ?"
+	if query != expected {
+		t.Errorf("got query %q, expected %q", query, expected)
+	}
+
+	if !slices.EqualFunc(args, []interface{}{uuid, 12, 3, 12, 3}, func(a, b interface{}) bool {
+		if a, ok := a.([]byte); ok {
+			return string(a) == string(b.([]byte))
+		}
+
+		return a == b
+	}) {
+		t.Errorf("got arguments %v", args)
+	}
+}
+
+// TestAccountStatsQueryEmpty checks that a save without stats or vouchers updates nothing
+func TestAccountStatsQueryEmpty(t *testing.T) {
+	var stats defs.GameStats
+	err := json.Unmarshal([]byte(`{}`), &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, _ := accountStatsQuery([]byte("0123456789abcdef"), stats, nil)
+	if query != "" {
+		t.Errorf("got query %q, expected none", query)
+	}
+}
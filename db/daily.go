@@ -18,14 +18,17 @@
 package db
 
 import (
-	"math"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
 
 	"github.com/pagefaultgames/rogueserver/defs"
 )
 
-func TryAddDailyRun(seed string) (string, error) {
+func TryAddDailyRun(ctx context.Context, seed string) (string, error) {
 	var actualSeed string
-	err := handle.QueryRow("INSERT INTO dailyRuns (seed, date) VALUES (?, UTC_DATE()) ON DUPLICATE KEY UPDATE date = date RETURNING seed", seed).Scan(&actualSeed)
+	err := queryRow(ctx, "INSERT INTO dailyRuns (seed, date) VALUES (?, UTC_DATE()) ON DUPLICATE KEY UPDATE date = date RETURNING seed", seed).Scan(&actualSeed)
 	if err != nil {
 		return "INVALID", err
 	}
@@ -33,9 +36,9 @@ func TryAddDailyRun(seed string) (string, error) {
 	return actualSeed, nil
 }
 
-func GetDailyRunSeed() (string, error) {
+func GetDailyRunSeed(ctx context.Context) (string, error) {
 	var seed string
-	err := handle.QueryRow("SELECT seed FROM dailyRuns WHERE date = UTC_DATE()").Scan(&seed)
+	err := queryRow(ctx, "SELECT seed FROM dailyRuns WHERE date = UTC_DATE()").Scan(&seed)
 	if err != nil {
 		return "INVALID", err
 	}
@@ -44,8 +47,131 @@ func GetDailyRunSeed() (string, error) {
 
 }
 
-func AddOrUpdateAccountDailyRun(uuid []byte, score int, wave int) error {
-	_, err := handle.Exec("INSERT INTO accountDailyRuns (uuid, date, score, wave, timestamp) VALUES (?, UTC_DATE(), ?, ?, UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE score = GREATEST(score, ?), wave = GREATEST(wave, ?), timestamp = IF(score < ?, UTC_TIMESTAMP(), timestamp)", uuid, score, wave, score, wave, score)
+// TryAddDailyChallengeSeed records seed as today's seed of challenge, returning the recorded seed if there already is one
+func TryAddDailyChallengeSeed(ctx context.Context, challenge, seed string) (string, error) {
+	var actualSeed string
+	err := queryRow(ctx, "INSERT INTO dailyChallengeSeeds (date, challenge, seed) VALUES (UTC_DATE(), ?, ?) ON DUPLICATE KEY UPDATE date = date RETURNING seed", challenge, seed).Scan(&actualSeed)
+	if err != nil {
+		return "INVALID", err
+	}
+
+	return actualSeed, nil
+}
+
+// FetchLatestDailySecret returns the latest version of the daily seed secret and when it was created, sql.ErrNoRows if there is none
+func FetchLatestDailySecret(ctx context.Context) (int, []byte, time.Time, error) {
+	var version int
+	var secret []byte
+	var created string
+	err := queryRow(ctx, "SELECT version, secret, created FROM dailySecrets ORDER BY version DESC LIMIT 1").Scan(&version, &secret, &created)
+	if err != nil {
+		return 0, nil, time.Time{}, err
+	}
+
+	createdTime, err := time.Parse(time.DateTime, created)
+	if err != nil {
+		return 0, nil, time.Time{}, fmt.Errorf("failed to parse daily secret creation time: %s", err)
+	}
+
+	return version, secret, createdTime, nil
+}
+
+// AddDailySecret stores secret as the next version of the daily seed secret if the latest version was created before createdBefore, or there is none.
+// It returns false if it didn't, e.g. because another instance rotated the secret first.
+func AddDailySecret(ctx context.Context, secret []byte, createdBefore time.Time) (bool, error) {
+	result, err := exec(ctx, "INSERT IGNORE INTO dailySecrets (version, secret, created) SELECT COALESCE(MAX(version), 0) + 1, ?, UTC_TIMESTAMP() FROM dailySecrets HAVING MAX(created) IS NULL OR MAX(created) < ?", secret, createdBefore.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	added, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return added > 0, nil
+}
+
+// TryAddDailySeedCommitment commits to seed as the seed of challenge on date, returning the committed seed if there already is one
+func TryAddDailySeedCommitment(ctx context.Context, date, challenge, seed, commitment string, secretVersion int) (string, error) {
+	var actualSeed string
+	err := queryRow(ctx, "INSERT INTO dailySeedCommitments (date, challenge, seed, commitment, secretVersion) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE date = date RETURNING seed", date, challenge, seed, commitment, secretVersion).Scan(&actualSeed)
+	if err != nil {
+		return "INVALID", err
+	}
+
+	return actualSeed, nil
+}
+
+// FetchDailySeedCommitment returns the seed of challenge committed to for date, sql.ErrNoRows if there is none
+func FetchDailySeedCommitment(ctx context.Context, date, challenge string) (string, error) {
+	var seed string
+	err := queryRow(ctx, "SELECT seed FROM dailySeedCommitments WHERE date = ? AND challenge = ?", date, challenge).Scan(&seed)
+	if err != nil {
+		return "", err
+	}
+
+	return seed, nil
+}
+
+// FetchDailySeedCommitments returns a page of the commitments to the seeds of challenge, newest first, with the seeds of days that started
+func FetchDailySeedCommitments(ctx context.Context, challenge string, page int) ([]defs.DailySeedCommitment, error) {
+	var commitments []defs.DailySeedCommitment
+
+	results, err := queryRows(ctx, "SELECT date, commitment, secretVersion, IF(date <= UTC_DATE(), seed, '') FROM dailySeedCommitments WHERE challenge = ? ORDER BY date DESC LIMIT 10 OFFSET ?", challenge, (page-1)*10)
+	if err != nil {
+		return commitments, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var commitment defs.DailySeedCommitment
+		err = results.Scan(&commitment.Date, &commitment.Commitment, &commitment.SecretVersion, &commitment.Seed)
+		if err != nil {
+			return commitments, err
+		}
+
+		commitments = append(commitments, commitment)
+	}
+
+	return commitments, nil
+}
+
+// FetchDailyChallengeSeeds returns today's seeds by challenge
+func FetchDailyChallengeSeeds(ctx context.Context) (map[string]string, error) {
+	seeds := make(map[string]string)
+
+	results, err := queryRows(ctx, "SELECT challenge, seed FROM dailyChallengeSeeds WHERE date = UTC_DATE()")
+	if err != nil {
+		return seeds, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var challenge, seed string
+		err = results.Scan(&challenge, &seed)
+		if err != nil {
+			return seeds, err
+		}
+
+		seeds[challenge] = seed
+	}
+
+	return seeds, nil
+}
+
+// AddOrUpdateAccountDailyRun records a run of today's challenge, hidden from rankings with hiddenReason if that isn't empty.
+// A stored run is replaced if the new one beats it, unless the new one is hidden and the stored one isn't.
+// Replacing never changes whether the run is hidden, only a moderator shows a hidden run again.
+func AddOrUpdateAccountDailyRun(ctx context.Context, uuid []byte, challenge string, score int, wave int, hiddenReason string) error {
+	hidden := hiddenReason != ""
+	reason := sql.NullString{String: hiddenReason, Valid: hidden}
+
+	// score is assigned last, the assignments before it see the stored score
+	replace := "score < ? AND (hidden = 1 OR ? = 0)"
+	_, err := exec(ctx, "INSERT INTO accountDailyRuns (uuid, date, challenge, score, wave, timestamp, hidden, hiddenReason) VALUES (?, UTC_DATE(), ?, ?, ?, UTC_TIMESTAMP(), ?, ?) ON DUPLICATE KEY UPDATE timestamp = IF("+replace+", UTC_TIMESTAMP(), timestamp), wave = IF("+replace+", GREATEST(wave, ?), wave), score = IF("+replace+", ?, score)", uuid, challenge, score, wave, hidden, reason, score, hidden, score, hidden, wave, score, hidden, score)
 	if err != nil {
 		return err
 	}
@@ -53,53 +179,258 @@ func AddOrUpdateAccountDailyRun(uuid []byte, score int, wave int) error {
 	return nil
 }
 
-func FetchRankings(category int, page int) ([]defs.DailyRanking, error) {
-	var rankings []defs.DailyRanking
+// ranking aggregations, how the scores of the daily runs in a ranking's period add up to a player's score
+var rankingAggregates = map[string]string{
+	"sum":     "SUM(adr.score)",
+	"best":    "MAX(adr.score)",
+	"average": "ROUND(AVG(adr.score))",
+}
 
-	offset := (page - 1) * 10
+// rankingQuery ranks the players with runs of the challenge given as its first argument from the dates given as the next two, scored by score.
+// Ties go to the player whose last counted run was recorded first, then by uuid, so every rank is unique.
+const rankingQuery = "SELECT RANK() OVER (ORDER BY %[1]s DESC, MAX(adr.timestamp), adr.uuid) AS place, a.username, %[1]s AS score, MAX(adr.wave) AS wave, MAX(adr.timestamp) AS last, adr.uuid FROM accountDailyRuns adr JOIN accounts a ON adr.uuid = a.uuid WHERE adr.challenge = ? AND adr.date BETWEEN ? AND ? AND adr.hidden = 0 AND a.banned = 0 GROUP BY adr.uuid, a.username"
 
-	var query string
-	switch category {
-	case 0:
-		query = "SELECT RANK() OVER (ORDER BY adr.score DESC, adr.timestamp), a.username, adr.score, adr.wave FROM accountDailyRuns adr JOIN dailyRuns dr ON dr.date = adr.date JOIN accounts a ON adr.uuid = a.uuid WHERE dr.date = UTC_DATE() AND a.banned = 0 LIMIT 10 OFFSET ?"
-	case 1:
-		query = "SELECT RANK() OVER (ORDER BY SUM(adr.score) DESC, adr.timestamp), a.username, SUM(adr.score), 0 FROM accountDailyRuns adr JOIN dailyRuns dr ON dr.date = adr.date JOIN accounts a ON adr.uuid = a.uuid WHERE dr.date >= DATE_SUB(DATE(UTC_TIMESTAMP()), INTERVAL DAYOFWEEK(UTC_TIMESTAMP()) - 1 DAY) AND a.banned = 0 GROUP BY a.username ORDER BY 1 LIMIT 10 OFFSET ?"
+// FetchRankingsFrom returns up to count rankings starting at rank over the runs of challenge from the dates from to to, inclusive, scored by aggregate
+func FetchRankingsFrom(ctx context.Context, challenge, aggregate, from, to string, rank, count int) ([]defs.DailyRanking, error) {
+	score, ok := rankingAggregates[aggregate]
+	if !ok {
+		return nil, fmt.Errorf("unknown ranking aggregate %q", aggregate)
 	}
 
-	results, err := handle.Query(query, offset)
+	results, err := queryRows(ctx, fmt.Sprintf("SELECT place, username, score, wave, last, uuid FROM ("+rankingQuery+") r ORDER BY place LIMIT ? OFFSET ?", score), challenge, from, to, count, rank-1)
 	if err != nil {
-		return rankings, err
+		return nil, err
 	}
 
+	return scanRankings(results)
+}
+
+// FetchRankingsAfter returns up to count rankings after cursor, see FetchRankingsFrom
+func FetchRankingsAfter(ctx context.Context, challenge, aggregate, from, to string, cursor defs.RankingCursor, count int) ([]defs.DailyRanking, error) {
+	score, ok := rankingAggregates[aggregate]
+	if !ok {
+		return nil, fmt.Errorf("unknown ranking aggregate %q", aggregate)
+	}
+
+	results, err := queryRows(ctx, fmt.Sprintf("SELECT place, username, score, wave, last, uuid FROM ("+rankingQuery+") r WHERE r.score < ? OR (r.score = ? AND (r.last > ? OR (r.last = ? AND r.uuid > ?))) ORDER BY place LIMIT ?", score), challenge, from, to, cursor.Score, cursor.Score, cursor.Timestamp, cursor.Timestamp, cursor.Uuid, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRankings(results)
+}
+
+func scanRankings(results rows) ([]defs.DailyRanking, error) {
 	defer results.Close()
 
+	rankings := []defs.DailyRanking{}
 	for results.Next() {
 		var ranking defs.DailyRanking
-		err = results.Scan(&ranking.Rank, &ranking.Username, &ranking.Score, &ranking.Wave)
+		var cursor defs.RankingCursor
+		err := results.Scan(&ranking.Rank, &ranking.Username, &ranking.Score, &ranking.Wave, &cursor.Timestamp, &cursor.Uuid)
 		if err != nil {
 			return rankings, err
 		}
 
+		cursor.Score = ranking.Score
+		ranking.Cursor = cursor.String()
+
 		rankings = append(rankings, ranking)
 	}
 
 	return rankings, nil
 }
 
-func FetchRankingPageCount(category int) (int, error) {
-	var query string
-	switch category {
-	case 0:
-		query = "SELECT COUNT(a.username) FROM accountDailyRuns adr JOIN dailyRuns dr ON dr.date = adr.date JOIN accounts a ON adr.uuid = a.uuid WHERE dr.date = UTC_DATE()"
-	case 1:
-		query = "SELECT COUNT(DISTINCT a.username) FROM accountDailyRuns adr JOIN dailyRuns dr ON dr.date = adr.date JOIN accounts a ON adr.uuid = a.uuid WHERE dr.date >= DATE_SUB(DATE(UTC_TIMESTAMP()), INTERVAL DAYOFWEEK(UTC_TIMESTAMP()) - 1 DAY)"
+// FetchRanking returns the ranking of uuid over the runs of challenge from the dates from to to, see FetchRankingsFrom.
+// The rank is counted from the players ahead rather than by ranking everyone, sql.ErrNoRows is returned if uuid isn't ranked.
+// Counting still aggregates every ranked run of the period, read through accountDailyRunsByChallenge, so it costs about as
+// much as a page of all-time rankings. It is only used without a leaderboard backend, cached leaderboards index ranks by uuid.
+func FetchRanking(ctx context.Context, uuid []byte, challenge, aggregate, from, to string) (defs.DailyRanking, error) {
+	var ranking defs.DailyRanking
+
+	score, ok := rankingAggregates[aggregate]
+	if !ok {
+		return ranking, fmt.Errorf("unknown ranking aggregate %q", aggregate)
+	}
+
+	cursor := defs.RankingCursor{Uuid: uuid}
+	err := queryRow(ctx, fmt.Sprintf("SELECT a.username, %s, MAX(adr.timestamp), MAX(adr.wave) FROM accountDailyRuns adr JOIN accounts a ON adr.uuid = a.uuid WHERE adr.uuid = ? AND adr.challenge = ? AND adr.date BETWEEN ? AND ? AND adr.hidden = 0 AND a.banned = 0 GROUP BY a.username", score), uuid, challenge, from, to).Scan(&ranking.Username, &ranking.Score, &cursor.Timestamp, &ranking.Wave)
+	if err != nil {
+		return ranking, err
 	}
 
-	var recordCount int
-	err := handle.QueryRow(query).Scan(&recordCount)
+	cursor.Score = ranking.Score
+	ranking.Cursor = cursor.String()
+
+	err = queryRow(ctx, fmt.Sprintf("SELECT COUNT(*) + 1 FROM (SELECT %s AS score, MAX(adr.timestamp) AS last, adr.uuid FROM accountDailyRuns adr JOIN accounts a ON adr.uuid = a.uuid WHERE adr.challenge = ? AND adr.date BETWEEN ? AND ? AND adr.hidden = 0 AND a.banned = 0 GROUP BY adr.uuid) r WHERE r.score > ? OR (r.score = ? AND (r.last < ? OR (r.last = ? AND r.uuid < ?)))", score), challenge, from, to, cursor.Score, cursor.Score, cursor.Timestamp, cursor.Timestamp, uuid).Scan(&ranking.Rank)
+	if err != nil {
+		return ranking, err
+	}
+
+	return ranking, nil
+}
+
+// FetchRankingCount returns the number of players ranked over the runs of challenge from the dates from to to, inclusive
+func FetchRankingCount(ctx context.Context, challenge, from, to string) (int, error) {
+	var count int
+	err := queryRow(ctx, "SELECT COUNT(DISTINCT adr.uuid) FROM accountDailyRuns adr JOIN accounts a ON adr.uuid = a.uuid WHERE adr.challenge = ? AND adr.date BETWEEN ? AND ? AND adr.hidden = 0 AND a.banned = 0", challenge, from, to).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
 
-	return int(math.Ceil(float64(recordCount) / 10)), nil
+	return count, nil
+}
+
+// FetchRankedDailyRuns returns the ranked runs of challenge from the dates from to to, inclusive
+func FetchRankedDailyRuns(ctx context.Context, challenge, from, to string) ([]defs.RankedDailyRun, error) {
+	var runs []defs.RankedDailyRun
+
+	results, err := queryRows(ctx, "SELECT adr.uuid, a.username, adr.date, adr.score, adr.wave, adr.timestamp FROM accountDailyRuns adr JOIN accounts a ON adr.uuid = a.uuid WHERE adr.challenge = ? AND adr.date BETWEEN ? AND ? AND adr.hidden = 0 AND a.banned = 0", challenge, from, to)
+	if err != nil {
+		return runs, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		run := defs.RankedDailyRun{Challenge: challenge, Ranked: true}
+		err = results.Scan(&run.Uuid, &run.Username, &run.Date, &run.Score, &run.Wave, &run.Timestamp)
+		if err != nil {
+			return runs, err
+		}
+
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// FetchRankedDailyRun returns today's run of challenge of uuid
+func FetchRankedDailyRun(ctx context.Context, uuid []byte, challenge string) (defs.RankedDailyRun, error) {
+	run := defs.RankedDailyRun{Uuid: uuid, Challenge: challenge}
+
+	err := queryRow(ctx, "SELECT a.username, adr.date, adr.score, adr.wave, adr.timestamp, adr.hidden = 0 AND a.banned = 0 FROM accountDailyRuns adr JOIN accounts a ON adr.uuid = a.uuid WHERE adr.uuid = ? AND adr.challenge = ? AND adr.date = UTC_DATE()", uuid, challenge).Scan(&run.Username, &run.Date, &run.Score, &run.Wave, &run.Timestamp, &run.Ranked)
+	if err != nil {
+		return run, err
+	}
+
+	return run, nil
+}
+
+// FetchDailySeeds returns a page of the seeds of challenge before today, newest first, with their participant counts and winners
+func FetchDailySeeds(ctx context.Context, challenge string, page int) ([]defs.DailySeed, error) {
+	var seeds []defs.DailySeed
+
+	results, err := queryRows(ctx, "SELECT dcs.date, dcs.seed, COUNT(adr.uuid), MAX(IF(adr.place = 1, adr.username, NULL)), MAX(IF(adr.place = 1, adr.score, NULL)), MAX(IF(adr.place = 1, adr.wave, NULL)) FROM (SELECT date, seed FROM dailyChallengeSeeds WHERE challenge = ? AND date < UTC_DATE() ORDER BY date DESC LIMIT 10 OFFSET ?) dcs LEFT JOIN (SELECT adr.uuid, adr.date, a.username, adr.score, adr.wave, ROW_NUMBER() OVER (PARTITION BY adr.date ORDER BY adr.score DESC, adr.timestamp, adr.uuid) AS place FROM accountDailyRuns adr JOIN accounts a ON adr.uuid = a.uuid WHERE adr.challenge = ? AND adr.date < UTC_DATE() AND adr.hidden = 0 AND a.banned = 0) adr ON adr.date = dcs.date GROUP BY dcs.date, dcs.seed ORDER BY dcs.date DESC", challenge, (page-1)*10, challenge)
+	if err != nil {
+		return seeds, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var seed defs.DailySeed
+		var username sql.NullString
+		var score, wave sql.NullInt64
+		err = results.Scan(&seed.Date, &seed.Seed, &seed.Participants, &username, &score, &wave)
+		if err != nil {
+			return seeds, err
+		}
+
+		if username.Valid {
+			seed.Winner = &defs.DailyRanking{Rank: 1, Username: username.String, Score: int(score.Int64), Wave: int(wave.Int64)}
+		}
+
+		seeds = append(seeds, seed)
+	}
+
+	return seeds, nil
+}
+
+// FetchDailyRunProgress returns what session updates have shown of a daily run so far
+func FetchDailyRunProgress(ctx context.Context, uuid []byte, seed string) (defs.DailyRunProgress, error) {
+	var progress defs.DailyRunProgress
+	var flag sql.NullString
+
+	err := queryRow(ctx, "SELECT wave, score, money, playTime, updates, TIMESTAMPDIFF(SECOND, firstUpdate, UTC_TIMESTAMP()), flag FROM dailyRunProgress WHERE uuid = ? AND seed = ?", uuid, seed).Scan(&progress.Wave, &progress.Score, &progress.Money, &progress.PlayTime, &progress.Updates, &progress.Elapsed, &flag)
+	if err != nil {
+		return progress, err
+	}
+
+	progress.Flag = flag.String
+
+	return progress, nil
+}
+
+// UpdateDailyRunProgress adds a session update to a daily run's progress, keeping the highest values seen and the first flag raised
+func UpdateDailyRunProgress(ctx context.Context, uuid []byte, seed string, wave, score, money, playTime int, flag string) error {
+	value := sql.NullString{String: flag, Valid: flag != ""}
+
+	_, err := exec(ctx, "INSERT INTO dailyRunProgress (uuid, seed, wave, score, money, playTime, updates, firstUpdate, lastUpdate, flag) VALUES (?, ?, ?, ?, ?, ?, 1, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?) ON DUPLICATE KEY UPDATE wave = GREATEST(wave, ?), score = GREATEST(score, ?), money = ?, playTime = GREATEST(playTime, ?), updates = updates + 1, lastUpdate = UTC_TIMESTAMP(), flag = COALESCE(flag, ?)", uuid, seed, wave, score, money, playTime, value, wave, score, money, playTime, value)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func DeleteDailyRunProgress(ctx context.Context, uuid []byte, seed string) error {
+	_, err := exec(ctx, "DELETE FROM dailyRunProgress WHERE uuid = ? AND seed = ?", uuid, seed)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteStaleDailyRunProgress removes the progress of runs that can no longer be cleared for a ranking
+func DeleteStaleDailyRunProgress(ctx context.Context) error {
+	_, err := exec(ctx, "DELETE FROM dailyRunProgress WHERE firstUpdate < DATE_SUB(UTC_TIMESTAMP(), INTERVAL 2 DAY)")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FetchHiddenDailyRuns returns a page of daily runs hidden from rankings, newest first
+func FetchHiddenDailyRuns(ctx context.Context, page int) ([]defs.HiddenDailyRun, error) {
+	var runs []defs.HiddenDailyRun
+
+	results, err := queryRows(ctx, "SELECT a.username, adr.date, adr.challenge, adr.score, adr.wave, COALESCE(adr.hiddenReason, '') FROM accountDailyRuns adr JOIN accounts a ON adr.uuid = a.uuid WHERE adr.hidden = 1 ORDER BY adr.date DESC, adr.score DESC LIMIT 50 OFFSET ?", (page-1)*50)
+	if err != nil {
+		return runs, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var run defs.HiddenDailyRun
+		err = results.Scan(&run.Username, &run.Date, &run.Challenge, &run.Score, &run.Wave, &run.Reason)
+		if err != nil {
+			return runs, err
+		}
+
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// SetDailyRunHidden hides a run of challenge from rankings or shows it, returning false if there is no such run
+func SetDailyRunHidden(ctx context.Context, username, date, challenge string, hidden bool) (bool, error) {
+	var count int
+	err := queryRow(ctx, "SELECT COUNT(*) FROM accountDailyRuns adr JOIN accounts a ON adr.uuid = a.uuid WHERE a.username = ? AND adr.date = ? AND adr.challenge = ?", username, date, challenge).Scan(&count)
+	if err != nil {
+		return false, err
+	} else if count == 0 {
+		return false, nil
+	}
+
+	_, err = exec(ctx, "UPDATE accountDailyRuns adr JOIN accounts a ON adr.uuid = a.uuid SET adr.hidden = ? WHERE a.username = ? AND adr.date = ? AND adr.challenge = ?", hidden, username, date, challenge)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
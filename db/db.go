@@ -18,17 +18,32 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/pagefaultgames/rogueserver/metrics"
+	"github.com/pagefaultgames/rogueserver/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-var handle *sql.DB
+// SchemaVersion is the version of the tables created by Init, bump it whenever they change
+const SchemaVersion = 9
+
+var (
+	handle *sql.DB
+
+	// deadlines for a single query, 0 disables them
+	ReadTimeout  = 5 * time.Second
+	WriteTimeout = 10 * time.Second
+)
 
 func Init(username, password, protocol, address, database string) error {
 	var err error
@@ -48,11 +63,25 @@ func Init(username, password, protocol, address, database string) error {
 
 	handle.SetConnMaxIdleTime(time.Second * 10)
 
+	metrics.RegisterDB(handle, database)
+
 	tx, err := handle.Begin()
 	if err != nil {
 		panic(err)
 	}
 
+	// version of the tables before Init, 0 if they don't exist yet
+	var storedVersion int
+	tx.QueryRow("SELECT version FROM schemaVersion WHERE id = 0").Scan(&storedVersion)
+
+	// migrate runs a statement of the current schema, skipping the rest once one failed so the schema version isn't bumped past it
+	var migrateErr error
+	migrate := func(query string, args ...any) {
+		if migrateErr == nil {
+			_, migrateErr = tx.Exec(query, args...)
+		}
+	}
+
 	// accounts
 	tx.Exec("CREATE TABLE IF NOT EXISTS accounts (uuid BINARY(16) NOT NULL PRIMARY KEY, username VARCHAR(16) UNIQUE NOT NULL, hash BINARY(32) NOT NULL, salt BINARY(16) NOT NULL, registered TIMESTAMP NOT NULL, lastLoggedIn TIMESTAMP DEFAULT NULL, lastActivity TIMESTAMP DEFAULT NULL, banned TINYINT(1) NOT NULL DEFAULT 0, trainerId SMALLINT(5) UNSIGNED DEFAULT 0, secretId SMALLINT(5) UNSIGNED DEFAULT 0)")
 
@@ -77,10 +106,59 @@ func Init(username, password, protocol, address, database string) error {
 	tx.Exec("CREATE TABLE IF NOT EXISTS accountDailyRuns (uuid BINARY(16) NOT NULL, date DATE NOT NULL, score INT(11) NOT NULL DEFAULT 0, wave INT(11) NOT NULL DEFAULT 0, timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (uuid, date), CONSTRAINT accountDailyRuns_ibfk_1 FOREIGN KEY (uuid) REFERENCES accounts (uuid) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT accountDailyRuns_ibfk_2 FOREIGN KEY (date) REFERENCES dailyRuns (date) ON DELETE NO ACTION ON UPDATE NO ACTION)")
 	tx.Exec("CREATE INDEX IF NOT EXISTS accountDailyRunsByDate ON accountDailyRuns (date)")
 
+	migrate("ALTER TABLE accountDailyRuns ADD COLUMN IF NOT EXISTS hidden TINYINT(1) NOT NULL DEFAULT 0, ADD COLUMN IF NOT EXISTS hiddenReason VARCHAR(255) DEFAULT NULL")
+	migrate("CREATE INDEX IF NOT EXISTS accountDailyRunsByDateAndScore ON accountDailyRuns (date, hidden, score)")
+
+	// daily challenges, runs from before them belong to the default challenge
+	migrate("CREATE TABLE IF NOT EXISTS dailyChallengeSeeds (date DATE NOT NULL, challenge VARCHAR(32) CHARACTER SET ascii COLLATE ascii_bin NOT NULL, seed CHAR(24) CHARACTER SET ascii COLLATE ascii_bin NOT NULL, PRIMARY KEY (date, challenge))")
+	migrate("INSERT IGNORE INTO dailyChallengeSeeds (date, challenge, seed) SELECT date, 'daily', seed FROM dailyRuns")
+	migrate("ALTER TABLE accountDailyRuns ADD COLUMN IF NOT EXISTS challenge VARCHAR(32) CHARACTER SET ascii COLLATE ascii_bin NOT NULL DEFAULT 'daily' AFTER date")
+	if storedVersion < 7 {
+		migrate("ALTER TABLE accountDailyRuns DROP PRIMARY KEY, ADD PRIMARY KEY (uuid, date, challenge)")
+	}
+	// rankings and the rank of a player aggregate every ranked run of their period through this index
+	migrate("CREATE INDEX IF NOT EXISTS accountDailyRunsByChallenge ON accountDailyRuns (challenge, date, hidden, score)")
+
+	// versions of the secret daily seeds are derived from, and the seeds committed to before their day by the hash of the seed
+	migrate("CREATE TABLE IF NOT EXISTS dailySecrets (version INT(11) NOT NULL PRIMARY KEY, secret VARBINARY(64) NOT NULL, created TIMESTAMP NOT NULL)")
+	migrate("CREATE TABLE IF NOT EXISTS dailySeedCommitments (date DATE NOT NULL, challenge VARCHAR(32) CHARACTER SET ascii COLLATE ascii_bin NOT NULL, seed CHAR(24) CHARACTER SET ascii COLLATE ascii_bin NOT NULL, commitment CHAR(64) CHARACTER SET ascii COLLATE ascii_bin NOT NULL, secretVersion INT(11) NOT NULL, PRIMARY KEY (date, challenge))")
+
+	// events, their runs are recorded as daily runs of the challenge "event-<id>"
+	migrate("CREATE TABLE IF NOT EXISTS events (id INT(11) NOT NULL AUTO_INCREMENT PRIMARY KEY, name VARCHAR(64) NOT NULL, startTime DATETIME NOT NULL, endTime DATETIME NOT NULL, gameMode INT(11) NOT NULL, waves INT(11) NOT NULL, seeds TEXT NOT NULL, rules TEXT NOT NULL, rewards TEXT NOT NULL, rewarded TINYINT(1) NOT NULL DEFAULT 0)")
+	migrate("CREATE INDEX IF NOT EXISTS eventsByEndTime ON events (endTime, rewarded)")
+
+	// shared leaderboards, a row per player versioned by the state of their leaderboard. They replace the encoded leaderboards table.
+	migrate("DROP TABLE IF EXISTS leaderboards")
+	migrate("CREATE TABLE IF NOT EXISTS leaderboardStates (cacheKey VARCHAR(64) CHARACTER SET ascii COLLATE ascii_bin NOT NULL PRIMARY KEY, generation BIGINT NOT NULL, version BIGINT NOT NULL, built TIMESTAMP(6) NOT NULL, modified TIMESTAMP(6) NOT NULL)")
+	migrate("CREATE TABLE IF NOT EXISTS leaderboardEntries (cacheKey VARCHAR(64) CHARACTER SET ascii COLLATE ascii_bin NOT NULL, uuid BINARY(16) NOT NULL, username VARCHAR(16) NOT NULL, runs MEDIUMBLOB NOT NULL, deleted TINYINT(1) NOT NULL DEFAULT 0, generation BIGINT NOT NULL, version BIGINT NOT NULL, PRIMARY KEY (cacheKey, uuid), INDEX leaderboardEntriesByVersion (cacheKey, generation, version))")
+
+	migrate("CREATE TABLE IF NOT EXISTS dailyRunProgress (uuid BINARY(16) NOT NULL, seed CHAR(24) CHARACTER SET ascii COLLATE ascii_bin NOT NULL, wave INT(11) NOT NULL, score INT(11) NOT NULL, money INT(11) NOT NULL, playTime INT(11) NOT NULL, updates INT(11) NOT NULL, firstUpdate TIMESTAMP NOT NULL, lastUpdate TIMESTAMP NOT NULL, flag VARCHAR(255) DEFAULT NULL, PRIMARY KEY (uuid, seed), CONSTRAINT dailyRunProgress_ibfk_1 FOREIGN KEY (uuid) REFERENCES accounts (uuid) ON DELETE CASCADE ON UPDATE CASCADE)")
+
 	// save data
 	tx.Exec("CREATE TABLE IF NOT EXISTS systemSaveData (uuid BINARY(16) PRIMARY KEY, data LONGBLOB, timestamp TIMESTAMP)")
 	tx.Exec("CREATE TABLE IF NOT EXISTS sessionSaveData (uuid BINARY(16), slot TINYINT, data LONGBLOB, timestamp TIMESTAMP, PRIMARY KEY (uuid, slot))")
 
+	// moderation
+	migrate("ALTER TABLE accounts ADD COLUMN IF NOT EXISTS moderator TINYINT(1) NOT NULL DEFAULT 0")
+	migrate("CREATE TABLE IF NOT EXISTS saveDataFindings (id INT(11) NOT NULL AUTO_INCREMENT PRIMARY KEY, uuid BINARY(16) NOT NULL, datatype TINYINT NOT NULL, slot TINYINT NOT NULL DEFAULT 0, rule VARCHAR(32) NOT NULL, action VARCHAR(8) NOT NULL, field VARCHAR(255) NOT NULL, message VARCHAR(255) NOT NULL, timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, CONSTRAINT saveDataFindings_ibfk_1 FOREIGN KEY (uuid) REFERENCES accounts (uuid) ON DELETE CASCADE ON UPDATE CASCADE)")
+	migrate("CREATE INDEX IF NOT EXISTS saveDataFindingsByUuid ON saveDataFindings (uuid)")
+
+	// run history
+	migrate("CREATE TABLE IF NOT EXISTS sessionHistory (id INT(11) NOT NULL AUTO_INCREMENT PRIMARY KEY, uuid BINARY(16) NOT NULL, seed CHAR(24) CHARACTER SET ascii COLLATE ascii_bin NOT NULL, gameMode INT(11) NOT NULL, result TINYINT NOT NULL, score INT(11) NOT NULL, wave INT(11) NOT NULL, data LONGBLOB NOT NULL, timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, CONSTRAINT sessionHistory_ibfk_1 FOREIGN KEY (uuid) REFERENCES accounts (uuid) ON DELETE CASCADE ON UPDATE CASCADE)")
+	migrate("CREATE INDEX IF NOT EXISTS sessionHistoryByUuid ON sessionHistory (uuid, id)")
+	migrate("CREATE INDEX IF NOT EXISTS sessionHistoryBySeed ON sessionHistory (seed, id)")
+
+	// rate limits
+	migrate("CREATE TABLE IF NOT EXISTS rateLimits (id VARCHAR(255) CHARACTER SET ascii COLLATE ascii_bin NOT NULL PRIMARY KEY, tokens DOUBLE NOT NULL, rate DOUBLE NOT NULL, burst INT(11) NOT NULL, allowed TINYINT(1) NOT NULL DEFAULT 0, updated TIMESTAMP(6) NOT NULL)")
+
+	// schema version
+	migrate("CREATE TABLE IF NOT EXISTS schemaVersion (id TINYINT(1) NOT NULL PRIMARY KEY DEFAULT 0, version INT(11) NOT NULL)")
+	migrate("INSERT INTO schemaVersion (id, version) VALUES (0, ?) ON DUPLICATE KEY UPDATE version = GREATEST(version, ?)", SchemaVersion, SchemaVersion)
+	if migrateErr != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to migrate the database to schema version %d: %s", SchemaVersion, migrateErr)
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		panic(err)
@@ -92,15 +170,13 @@ func Init(username, password, protocol, address, database string) error {
 		if os.IsNotExist(err) { // not found, do not migrate
 			return nil
 		} else {
-			log.Fatalf("failed to stat userdata directory: %s", err)
-			return err
+			return fmt.Errorf("failed to stat userdata directory: %s", err)
 		}
 	}
 
 	entries, err := os.ReadDir("userdata")
 	if err != nil {
-		log.Fatalln(err)
-		return nil
+		return fmt.Errorf("failed to read userdata directory: %s", err)
 	}
 
 	for _, entry := range entries {
@@ -111,12 +187,12 @@ func Init(username, password, protocol, address, database string) error {
 		uuidString := entry.Name()
 		uuid, err := hex.DecodeString(uuidString)
 		if err != nil {
-			log.Printf("failed to decode uuid: %s", err)
+			slog.Warn("failed to decode legacy uuid", "uuid", uuidString, "error", err)
 			continue
 		}
 
 		var count int
-		err = handle.QueryRow("SELECT COUNT(*) FROM systemSaveData WHERE uuid = ?", uuid).Scan(&count)
+		err = queryRow(context.Background(), "SELECT COUNT(*) FROM systemSaveData WHERE uuid = ?", uuid).Scan(&count)
 		if err != nil || count != 0 {
 			continue
 		}
@@ -124,33 +200,32 @@ func Init(username, password, protocol, address, database string) error {
 		// store new system data
 		systemData, err := LegacyReadSystemSaveData(uuid)
 		if err != nil {
-			log.Printf("failed to read system save data for %v: %s", uuidString, err)
+			slog.Warn("failed to read legacy system save data", "uuid", uuidString, "error", err)
 			continue
 		}
 
-		err = StoreSystemSaveData(uuid, systemData)
+		err = StoreSystemSaveData(context.Background(), uuid, systemData)
 		if err != nil {
-			log.Fatalf("failed to store system save data for %v: %s\n", uuidString, err)
-			continue
+			return fmt.Errorf("failed to store system save data for %v: %s", uuidString, err)
 		}
 
 		// delete old system data
 		err = os.Remove("userdata/" + uuidString + "/system.pzs")
 		if err != nil {
-			log.Fatalf("failed to remove legacy system save data for %v: %s", uuidString, err)
+			return fmt.Errorf("failed to remove legacy system save data for %v: %s", uuidString, err)
 		}
 
 		for i := 0; i < 5; i++ {
 			sessionData, err := LegacyReadSessionSaveData(uuid, i)
 			if err != nil {
-				log.Printf("failed to read session save data %v for %v: %s", i, uuidString, err)
+				slog.Warn("failed to read legacy session save data", "uuid", uuidString, "slot", i, "error", err)
 				continue
 			}
 
 			// store new session data
-			err = StoreSessionSaveData(uuid, sessionData, i)
+			err = StoreSessionSaveData(context.Background(), uuid, sessionData, i)
 			if err != nil {
-				log.Fatalf("failed to store session save data for %v: %s\n", uuidString, err)
+				return fmt.Errorf("failed to store session save data for %v: %s", uuidString, err)
 			}
 
 			// delete old session data
@@ -160,10 +235,118 @@ func Init(username, password, protocol, address, database string) error {
 			}
 			err = os.Remove(fmt.Sprintf("userdata/%s/%s.pzs", uuidString, filename))
 			if err != nil {
-				log.Fatalf("failed to remove legacy session save data %v for %v: %s", i, uuidString, err)
+				return fmt.Errorf("failed to remove legacy session save data %v for %v: %s", i, uuidString, err)
 			}
 		}
 	}
 
 	return nil
 }
+
+func Ping(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	return handle.PingContext(ctx)
+}
+
+func FetchSchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := queryRow(ctx, "SELECT version FROM schemaVersion WHERE id = 0").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Close closes the connection pool once all queries have finished
+func Close() error {
+	return handle.Close()
+}
+
+/*
+	All queries go through the functions below so each one gets its own span and deadline.
+	The query of a row runs when it is scanned, the deadline of rows is released once they are closed.
+*/
+
+// row is a query for a single row, run by Scan so that its span and deadline cover reading the row and end with it
+type row struct {
+	ctx   context.Context
+	query string
+	args  []any
+}
+
+func (r row) Scan(dest ...any) error {
+	ctx, span := tracing.Start(r.ctx, operationName(r.query), semconv.DBSystemMySQL, semconv.DBQueryText(r.query))
+
+	ctx, cancel := withTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	err := handle.QueryRowContext(ctx, r.query, r.args...).Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		// a missing row is a result, not a failed query
+		tracing.End(span, nil)
+	} else {
+		tracing.End(span, err)
+	}
+
+	return err
+}
+
+type rows struct {
+	*sql.Rows
+	cancel context.CancelFunc
+}
+
+func (r rows) Close() error {
+	defer r.cancel()
+
+	return r.Rows.Close()
+}
+
+func exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := tracing.Start(ctx, operationName(query), semconv.DBSystemMySQL, semconv.DBQueryText(query))
+
+	ctx, cancel := withTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	result, err := handle.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+
+	return result, err
+}
+
+func queryRow(ctx context.Context, query string, args ...any) row {
+	return row{ctx: ctx, query: query, args: args}
+}
+
+func queryRows(ctx context.Context, query string, args ...any) (rows, error) {
+	ctx, span := tracing.Start(ctx, operationName(query), semconv.DBSystemMySQL, semconv.DBQueryText(query))
+
+	ctx, cancel := withTimeout(ctx, ReadTimeout)
+
+	r, err := handle.QueryContext(ctx, query, args...)
+	tracing.End(span, err)
+	if err != nil {
+		cancel()
+		return rows{}, err
+	}
+
+	return rows{Rows: r, cancel: cancel}, nil
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// operationName names a query's span after its statement type, e.g. "db SELECT"
+func operationName(query string) string {
+	operation, _, _ := strings.Cut(query, " ")
+
+	return "db " + operation
+}
@@ -0,0 +1,231 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const eventColumns = "id, name, startTime, endTime, gameMode, waves, seeds, rules, rewards, rewarded"
+
+// AddEvent stores a new event and returns its id
+func AddEvent(ctx context.Context, event defs.Event) (int, error) {
+	seeds, rules, rewards, err := encodeEventLists(event)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := exec(ctx, "INSERT INTO events (name, startTime, endTime, gameMode, waves, seeds, rules, rewards) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", event.Name, event.Start.UTC(), event.End.UTC(), event.GameMode, event.Waves, seeds, rules, rewards)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// UpdateEvent replaces the stored event with the id of event, false if there is none or it was already rewarded
+func UpdateEvent(ctx context.Context, event defs.Event) (bool, error) {
+	seeds, rules, rewards, err := encodeEventLists(event)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := exec(ctx, "UPDATE events SET name = ?, startTime = ?, endTime = ?, gameMode = ?, waves = ?, seeds = ?, rules = ?, rewards = ? WHERE id = ? AND rewarded = 0", event.Name, event.Start.UTC(), event.End.UTC(), event.GameMode, event.Waves, seeds, rules, rewards, event.Id)
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return updated > 0, nil
+}
+
+// DeleteEvent deletes the event with id if it hasn't started, false if there is no such event
+func DeleteEvent(ctx context.Context, id int) (bool, error) {
+	result, err := exec(ctx, "DELETE FROM events WHERE id = ? AND startTime > UTC_TIMESTAMP()", id)
+	if err != nil {
+		return false, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return deleted > 0, nil
+}
+
+func FetchEvent(ctx context.Context, id int) (defs.Event, error) {
+	return scanEvent(queryRow(ctx, "SELECT "+eventColumns+" FROM events WHERE id = ?", id))
+}
+
+// FetchEvents returns a page of events, latest start first
+func FetchEvents(ctx context.Context, page int) ([]defs.Event, error) {
+	return fetchEvents(ctx, "SELECT "+eventColumns+" FROM events ORDER BY startTime DESC, id DESC LIMIT 10 OFFSET ?", (page-1)*10)
+}
+
+// FetchUnfinishedEvents returns the events that are running or upcoming
+func FetchUnfinishedEvents(ctx context.Context) ([]defs.Event, error) {
+	return fetchEvents(ctx, "SELECT "+eventColumns+" FROM events WHERE endTime > UTC_TIMESTAMP() ORDER BY startTime")
+}
+
+// FetchUnrewardedEvents returns the events that ended without their rewards being delivered
+func FetchUnrewardedEvents(ctx context.Context) ([]defs.Event, error) {
+	return fetchEvents(ctx, "SELECT "+eventColumns+" FROM events WHERE endTime <= UTC_TIMESTAMP() AND rewarded = 0 ORDER BY endTime")
+}
+
+// RewardEvent adds the compensations of the rewards of an ended event for its players, ranked over their best runs of challenge,
+// and marks it rewarded in one transaction. It returns false if the event was already rewarded, e.g. by another instance.
+func RewardEvent(ctx context.Context, event defs.Event, challenge string) (bool, error) {
+	ctx, span := tracing.Start(ctx, "db REWARD", semconv.DBSystemMySQL)
+
+	ctx, cancel := withTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	rewarded, err := rewardEvent(ctx, event, challenge)
+	tracing.End(span, err)
+
+	return rewarded, err
+}
+
+func rewardEvent(ctx context.Context, event defs.Event, challenge string) (bool, error) {
+	tx, err := handle.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE events SET rewarded = 1 WHERE id = ? AND rewarded = 0 AND endTime <= UTC_TIMESTAMP()", event.Id)
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if updated == 0 {
+		return false, nil
+	}
+
+	rankings := fmt.Sprintf(rankingQuery, rankingAggregates["best"])
+	from, to := event.Start.UTC().Format(time.DateOnly), event.End.UTC().Format(time.DateOnly)
+
+	for _, reward := range event.Rewards {
+		_, err = tx.ExecContext(ctx, "INSERT INTO accountCompensations (uuid, voucherType, count) SELECT r.uuid, ?, ? FROM ("+rankings+") r WHERE ? = 0 OR r.place <= ?", reward.VoucherType, reward.Count, challenge, from, to, reward.Rank, reward.Rank)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func fetchEvents(ctx context.Context, query string, args ...any) ([]defs.Event, error) {
+	var events []defs.Event
+
+	results, err := queryRows(ctx, query, args...)
+	if err != nil {
+		return events, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		event, err := scanEvent(results)
+		if err != nil {
+			return events, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func scanEvent(row interface{ Scan(dest ...any) error }) (defs.Event, error) {
+	var event defs.Event
+	var start, end string
+	var seeds, rules, rewards []byte
+
+	err := row.Scan(&event.Id, &event.Name, &start, &end, &event.GameMode, &event.Waves, &seeds, &rules, &rewards, &event.Rewarded)
+	if err != nil {
+		return event, err
+	}
+
+	event.Start, err = time.Parse(time.DateTime, start)
+	if err != nil {
+		return event, fmt.Errorf("failed to parse event start: %s", err)
+	}
+
+	event.End, err = time.Parse(time.DateTime, end)
+	if err != nil {
+		return event, fmt.Errorf("failed to parse event end: %s", err)
+	}
+
+	err = json.Unmarshal(seeds, &event.Seeds)
+	if err == nil {
+		err = json.Unmarshal(rules, &event.Rules)
+	}
+	if err == nil {
+		err = json.Unmarshal(rewards, &event.Rewards)
+	}
+	if err != nil {
+		return event, fmt.Errorf("failed to decode event %d: %s", event.Id, err)
+	}
+
+	return event, nil
+}
+
+// encodeEventLists encodes the list fields of event as JSON for their columns
+func encodeEventLists(event defs.Event) (seeds, rules, rewards []byte, err error) {
+	seeds, err = json.Marshal(event.Seeds)
+	if err == nil {
+		rules, err = json.Marshal(event.Rules)
+	}
+	if err == nil {
+		rewards, err = json.Marshal(event.Rewards)
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to encode event: %s", err)
+	}
+
+	return seeds, rules, rewards, nil
+}
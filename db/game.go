@@ -17,9 +17,13 @@
 
 package db
 
-func FetchPlayerCount() (int, error) {
+import (
+	"context"
+)
+
+func FetchPlayerCount(ctx context.Context) (int, error) {
 	var playerCount int
-	err := handle.QueryRow("SELECT COUNT(*) FROM accounts WHERE lastActivity > DATE_SUB(UTC_TIMESTAMP(), INTERVAL 5 MINUTE)").Scan(&playerCount)
+	err := queryRow(ctx, "SELECT COUNT(*) FROM accounts WHERE lastActivity > DATE_SUB(UTC_TIMESTAMP(), INTERVAL 5 MINUTE)").Scan(&playerCount)
 	if err != nil {
 		return 0, err
 	}
@@ -27,9 +31,9 @@ func FetchPlayerCount() (int, error) {
 	return playerCount, nil
 }
 
-func FetchBattleCount() (int, error) {
+func FetchBattleCount(ctx context.Context) (int, error) {
 	var battleCount int
-	err := handle.QueryRow("SELECT COALESCE(SUM(battles), 0) FROM accountStats").Scan(&battleCount)
+	err := queryRow(ctx, "SELECT COALESCE(SUM(battles), 0) FROM accountStats").Scan(&battleCount)
 	if err != nil {
 		return 0, err
 	}
@@ -37,9 +41,9 @@ func FetchBattleCount() (int, error) {
 	return battleCount, nil
 }
 
-func FetchClassicSessionCount() (int, error) {
+func FetchClassicSessionCount(ctx context.Context) (int, error) {
 	var classicSessionCount int
-	err := handle.QueryRow("SELECT COALESCE(SUM(classicSessionsPlayed), 0) FROM accountStats").Scan(&classicSessionCount)
+	err := queryRow(ctx, "SELECT COALESCE(SUM(classicSessionsPlayed), 0) FROM accountStats").Scan(&classicSessionCount)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,96 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"context"
+
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+func AddSessionHistory(ctx context.Context, uuid []byte, run defs.SessionHistoryData) error {
+	buf, err := encodeGob(ctx, run)
+	if err != nil {
+		return err
+	}
+
+	_, err = exec(ctx, "INSERT INTO sessionHistory (uuid, seed, gameMode, result, score, wave, data, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())", uuid, run.Seed, run.GameMode, run.Result, run.Score, run.WaveIndex, buf)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FetchSessionHistory returns a page of the runs of an account, newest first
+func FetchSessionHistory(ctx context.Context, uuid []byte, page int) ([]defs.SessionHistoryEntry, error) {
+	return fetchSessionHistory(ctx, "WHERE h.uuid = ?", uuid, page)
+}
+
+// FetchSessionHistoryBySeed returns a page of the runs of any account played with seed, newest first
+func FetchSessionHistoryBySeed(ctx context.Context, seed string, page int) ([]defs.SessionHistoryEntry, error) {
+	return fetchSessionHistory(ctx, "WHERE h.seed = ?", seed, page)
+}
+
+// FetchSessionHistoryEntry returns a run of an account by id
+func FetchSessionHistoryEntry(ctx context.Context, uuid []byte, id int) (defs.SessionHistoryEntry, error) {
+	entry := defs.SessionHistoryEntry{Id: id}
+
+	var data []byte
+	err := queryRow(ctx, "SELECT a.username, h.data FROM sessionHistory h JOIN accounts a ON a.uuid = h.uuid WHERE h.id = ? AND h.uuid = ?", id, uuid).Scan(&entry.Username, &data)
+	if err != nil {
+		return entry, err
+	}
+
+	err = decodeGob(ctx, data, &entry.Run)
+	if err != nil {
+		return entry, err
+	}
+
+	return entry, nil
+}
+
+func fetchSessionHistory(ctx context.Context, condition string, arg any, page int) ([]defs.SessionHistoryEntry, error) {
+	var entries []defs.SessionHistoryEntry
+
+	results, err := queryRows(ctx, "SELECT h.id, a.username, h.data FROM sessionHistory h JOIN accounts a ON a.uuid = h.uuid "+condition+" ORDER BY h.id DESC LIMIT 10 OFFSET ?", arg, (page-1)*10)
+	if err != nil {
+		return entries, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var entry defs.SessionHistoryEntry
+		var data []byte
+
+		err = results.Scan(&entry.Id, &entry.Username, &data)
+		if err != nil {
+			return entries, err
+		}
+
+		err = decodeGob(ctx, data, &entry.Run)
+		if err != nil {
+			return entries, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,249 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pagefaultgames/rogueserver/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+/*
+	Shared leaderboards are stored as a row per player, so that recording a run only writes that player's row.
+	Every write bumps the version of the leaderboard and stamps the rows it wrote with it, so instances catch up
+	by reading the rows changed since the version they have. Removed players are kept as deleted rows until the
+	leaderboard is rebuilt, which replaces every row under a new generation.
+*/
+
+// LeaderboardState is the version of a stored leaderboard
+type LeaderboardState struct {
+	Generation int64
+	Version    int64
+	Built      time.Time
+	Modified   time.Time
+}
+
+// LeaderboardEntry is a player on a stored leaderboard with their runs encoded as JSON, Deleted if they were removed from it
+type LeaderboardEntry struct {
+	Uuid     []byte
+	Username string
+	Runs     []byte
+	Deleted  bool
+}
+
+// LeaderboardWrite is what UpdateLeaderboard stores
+type LeaderboardWrite struct {
+	// Delete deletes the leaderboard
+	Delete bool
+
+	// Replace replaces every stored entry with Entries under a new generation, otherwise Entries are added or replaced
+	Replace bool
+
+	Entries  []LeaderboardEntry
+	Built    time.Time
+	Modified time.Time
+}
+
+// leaderboardBatchSize is how many entries are inserted per statement
+const leaderboardBatchSize = 500
+
+// FetchLeaderboard returns the state of the leaderboard stored under key with the entries changed since local, every entry if full.
+// It returns sql.ErrNoRows if there is no such leaderboard.
+func FetchLeaderboard(ctx context.Context, key string, local LeaderboardState) (state LeaderboardState, entries []LeaderboardEntry, full bool, err error) {
+	ctx, span := tracing.Start(ctx, "db SELECT", semconv.DBSystemMySQL)
+
+	ctx, cancel := withTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	// one snapshot, so the entries match the state
+	tx, err := handle.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err == nil {
+		state, entries, full, err = fetchLeaderboard(ctx, tx, key, local, "")
+		tx.Rollback()
+	}
+	if err == nil && state.Generation == 0 {
+		err = sql.ErrNoRows
+	}
+	tracing.End(span, err)
+
+	return state, entries, full, err
+}
+
+// UpdateLeaderboard calls update with the state of the leaderboard stored under key, nil if there is none, and the entries changed since local,
+// every entry if full. It stores what update returns, unless it fails, and returns the new state. Updates of a leaderboard are serialized across instances.
+func UpdateLeaderboard(ctx context.Context, key string, local LeaderboardState, update func(stored *LeaderboardState, entries []LeaderboardEntry, full bool) (LeaderboardWrite, error)) (LeaderboardState, error) {
+	ctx, span := tracing.Start(ctx, "db UPDATE", semconv.DBSystemMySQL)
+
+	ctx, cancel := withTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	state, err := updateLeaderboard(ctx, key, local, update)
+	tracing.End(span, err)
+
+	return state, err
+}
+
+func updateLeaderboard(ctx context.Context, key string, local LeaderboardState, update func(stored *LeaderboardState, entries []LeaderboardEntry, full bool) (LeaderboardWrite, error)) (LeaderboardState, error) {
+	tx, err := handle.BeginTx(ctx, nil)
+	if err != nil {
+		return LeaderboardState{}, err
+	}
+
+	defer tx.Rollback()
+
+	// a row to lock even if the leaderboard isn't stored yet, generation 0 stands for none
+	_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO leaderboardStates (cacheKey, generation, version, built, modified) VALUES (?, 0, 0, UTC_TIMESTAMP(6), UTC_TIMESTAMP(6))", key)
+	if err != nil {
+		return LeaderboardState{}, err
+	}
+
+	state, entries, full, err := fetchLeaderboard(ctx, tx, key, local, " FOR UPDATE")
+	if err != nil {
+		return LeaderboardState{}, err
+	}
+
+	var stored *LeaderboardState
+	if state.Generation > 0 {
+		stored = &state
+	}
+
+	write, err := update(stored, entries, full)
+	if err != nil {
+		return LeaderboardState{}, err
+	}
+
+	if write.Delete {
+		_, err = tx.ExecContext(ctx, "DELETE FROM leaderboardEntries WHERE cacheKey = ?", key)
+		if err != nil {
+			return LeaderboardState{}, err
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM leaderboardStates WHERE cacheKey = ?", key)
+		if err != nil {
+			return LeaderboardState{}, err
+		}
+
+		return LeaderboardState{}, tx.Commit()
+	}
+
+	state.Version++
+	if write.Replace {
+		state.Generation++
+		state.Version = 1
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM leaderboardEntries WHERE cacheKey = ?", key)
+		if err != nil {
+			return LeaderboardState{}, err
+		}
+	}
+
+	state.Built = write.Built
+	state.Modified = write.Modified
+
+	for start := 0; start < len(write.Entries); start += leaderboardBatchSize {
+		batch := write.Entries[start:min(start+leaderboardBatchSize, len(write.Entries))]
+
+		args := make([]any, 0, len(batch)*7)
+		for _, entry := range batch {
+			args = append(args, key, entry.Uuid, entry.Username, entry.Runs, entry.Deleted, state.Generation, state.Version)
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO leaderboardEntries (cacheKey, uuid, username, runs, deleted, generation, version) VALUES "+strings.Repeat("(?, ?, ?, ?, ?, ?, ?), ", len(batch)-1)+"(?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE username = VALUES(username), runs = VALUES(runs), deleted = VALUES(deleted), generation = VALUES(generation), version = VALUES(version)", args...)
+		if err != nil {
+			return LeaderboardState{}, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE leaderboardStates SET generation = ?, version = ?, built = ?, modified = ? WHERE cacheKey = ?", state.Generation, state.Version, state.Built, state.Modified, key)
+	if err != nil {
+		return LeaderboardState{}, err
+	}
+
+	return state, tx.Commit()
+}
+
+// fetchLeaderboard reads the state of a leaderboard with lock appended to the query, and the entries changed since local
+func fetchLeaderboard(ctx context.Context, tx *sql.Tx, key string, local LeaderboardState, lock string) (LeaderboardState, []LeaderboardEntry, bool, error) {
+	var state LeaderboardState
+	err := tx.QueryRowContext(ctx, "SELECT generation, version, built, modified FROM leaderboardStates WHERE cacheKey = ?"+lock, key).Scan(&state.Generation, &state.Version, &state.Built, &state.Modified)
+	if err != nil {
+		return state, nil, false, err
+	}
+
+	if state.Generation == 0 {
+		return state, nil, false, nil
+	}
+
+	full := state.Generation != local.Generation
+	since := local.Version
+	if full {
+		since = 0
+	}
+
+	if state.Version == since {
+		return state, nil, full, nil
+	}
+
+	results, err := tx.QueryContext(ctx, "SELECT uuid, username, runs, deleted FROM leaderboardEntries WHERE cacheKey = ? AND generation = ? AND version > ?", key, state.Generation, since)
+	if err != nil {
+		return state, nil, false, err
+	}
+
+	defer results.Close()
+
+	var entries []LeaderboardEntry
+	for results.Next() {
+		var entry LeaderboardEntry
+		err = results.Scan(&entry.Uuid, &entry.Username, &entry.Runs, &entry.Deleted)
+		if err != nil {
+			return state, nil, false, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return state, entries, full, results.Err()
+}
+
+// FetchLeaderboardKeys returns the keys of the stored leaderboards
+func FetchLeaderboardKeys(ctx context.Context) ([]string, error) {
+	var keys []string
+
+	results, err := queryRows(ctx, "SELECT cacheKey FROM leaderboardStates WHERE generation > 0")
+	if err != nil {
+		return keys, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var key string
+		err = results.Scan(&key)
+		if err != nil {
+			return keys, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
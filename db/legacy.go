@@ -20,6 +20,7 @@ package db
 import (
 	"encoding/gob"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
@@ -45,11 +46,17 @@ func LegacyReadSystemSaveData(uuid []byte) (defs.SystemSaveData, error) {
 
 	defer zstdDecoder.Close()
 
-	err = gob.NewDecoder(zstdDecoder).Decode(&system)
+	var untyped untypedSystemSaveData
+	err = gob.NewDecoder(zstdDecoder).Decode(&untyped)
 	if err != nil {
 		return system, fmt.Errorf("failed to deserialize save: %s", err)
 	}
 
+	err = convertUntyped(untyped, &system)
+	if err != nil {
+		return system, fmt.Errorf("failed to convert save: %s", err)
+	}
+
 	return system, nil
 }
 
@@ -75,10 +82,92 @@ func LegacyReadSessionSaveData(uuid []byte, slotID int) (defs.SessionSaveData, e
 
 	defer zstdDecoder.Close()
 
-	err = gob.NewDecoder(zstdDecoder).Decode(&session)
+	var untyped untypedSessionSaveData
+	err = gob.NewDecoder(zstdDecoder).Decode(&untyped)
 	if err != nil {
 		return session, fmt.Errorf("failed to deserialize save: %s", err)
 	}
 
+	err = convertUntyped(untyped, &session)
+	if err != nil {
+		return session, fmt.Errorf("failed to convert save: %s", err)
+	}
+
 	return session, nil
 }
+
+/*
+	Saves stored before their payloads were typed hold interface{} values, which gob can't decode
+	into the typed structs. They're decoded into the untyped shapes below instead and converted
+	through JSON, which applies the same checks as saves sent by clients.
+*/
+
+type untypedSystemSaveData struct {
+	TrainerId          int                         `json:"trainerId"`
+	SecretId           int                         `json:"secretId"`
+	Gender             int                         `json:"gender"`
+	DexData            map[int]untypedDexEntry     `json:"dexData"`
+	StarterData        map[int]untypedStarterEntry `json:"starterData"`
+	StarterMoveData    map[int]interface{}         `json:"starterMoveData"`
+	StarterEggMoveData defs.StarterEggMoveData     `json:"starterEggMoveData"`
+	GameStats          interface{}                 `json:"gameStats"`
+	Unlocks            defs.Unlocks                `json:"unlocks"`
+	AchvUnlocks        defs.AchvUnlocks            `json:"achvUnlocks"`
+	VoucherUnlocks     defs.VoucherUnlocks         `json:"voucherUnlocks"`
+	VoucherCounts      defs.VoucherCounts          `json:"voucherCounts"`
+	Eggs               []defs.EggData              `json:"eggs"`
+	GameVersion        string                      `json:"gameVersion"`
+	Timestamp          int                         `json:"timestamp"`
+}
+
+type untypedDexEntry struct {
+	SeenAttr     interface{} `json:"seenAttr"`
+	CaughtAttr   interface{} `json:"caughtAttr"`
+	NatureAttr   int         `json:"natureAttr"`
+	SeenCount    int         `json:"seenCount"`
+	CaughtCount  int         `json:"caughtCount"`
+	HatchedCount int         `json:"hatchedCount"`
+	Ivs          []int       `json:"ivs"`
+}
+
+type untypedStarterEntry struct {
+	Moveset         interface{} `json:"moveset"`
+	EggMoves        int         `json:"eggMoves"`
+	CandyCount      int         `json:"candyCount"`
+	Friendship      int         `json:"friendship"`
+	AbilityAttr     int         `json:"abilityAttr"`
+	PassiveAttr     int         `json:"passiveAttr"`
+	ValueReduction  int         `json:"valueReduction"`
+	ClassicWinCount int         `json:"classicWinCount"`
+}
+
+type untypedSessionSaveData struct {
+	Seed           string              `json:"seed"`
+	PlayTime       int                 `json:"playTime"`
+	GameMode       defs.GameMode       `json:"gameMode"`
+	Party          []interface{}       `json:"party"`
+	EnemyParty     []interface{}       `json:"enemyParty"`
+	Modifiers      []interface{}       `json:"modifiers"`
+	EnemyModifiers []interface{}       `json:"enemyModifiers"`
+	Arena          interface{}         `json:"arena"`
+	PokeballCounts defs.PokeballCounts `json:"pokeballCounts"`
+	Money          int                 `json:"money"`
+	Score          int                 `json:"score"`
+	VictoryCount   int                 `json:"victoryCount"`
+	FaintCount     int                 `json:"faintCount"`
+	ReviveCount    int                 `json:"reviveCount"`
+	WaveIndex      int                 `json:"waveIndex"`
+	BattleType     defs.BattleType     `json:"battleType"`
+	Trainer        interface{}         `json:"trainer"`
+	GameVersion    string              `json:"gameVersion"`
+	Timestamp      int                 `json:"timestamp"`
+}
+
+func convertUntyped(untyped any, typed any) error {
+	data, err := json.Marshal(untyped)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, typed)
+}
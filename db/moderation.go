@@ -0,0 +1,113 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+func IsAccountModerator(ctx context.Context, uuid []byte) (bool, error) {
+	var moderator bool
+	err := queryRow(ctx, "SELECT moderator FROM accounts WHERE uuid = ?", uuid).Scan(&moderator)
+	if err != nil {
+		return false, err
+	}
+
+	return moderator, nil
+}
+
+func AddSaveDataFindings(ctx context.Context, uuid []byte, datatype, slot int, findings []defs.SaveDataFinding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+
+	query := "INSERT INTO saveDataFindings (uuid, datatype, slot, rule, action, field, message, timestamp) VALUES "
+
+	var args []interface{}
+	for i, finding := range findings {
+		if i > 0 {
+			query += ", "
+		}
+
+		query += "(?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())"
+		args = append(args, uuid, datatype, slot, finding.Rule, finding.Action, truncate(finding.Field, 255), truncate(finding.Message, 255))
+	}
+
+	_, err := exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FetchSaveDataFindings returns a page of findings, newest first, optionally only those of username or with action
+func FetchSaveDataFindings(ctx context.Context, username, action string, page int) ([]defs.SaveDataFinding, error) {
+	var findings []defs.SaveDataFinding
+
+	var conditions []string
+	var args []interface{}
+
+	if username != "" {
+		conditions = append(conditions, "a.username = ?")
+		args = append(args, username)
+	}
+
+	if action != "" {
+		conditions = append(conditions, "f.action = ?")
+		args = append(args, action)
+	}
+
+	query := "SELECT f.id, a.username, f.datatype, f.slot, f.rule, f.action, f.field, f.message, f.timestamp FROM saveDataFindings f JOIN accounts a ON a.uuid = f.uuid"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += " ORDER BY f.id DESC LIMIT 50 OFFSET ?"
+	args = append(args, (page-1)*50)
+
+	results, err := queryRows(ctx, query, args...)
+	if err != nil {
+		return findings, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var finding defs.SaveDataFinding
+		err = results.Scan(&finding.Id, &finding.Username, &finding.Datatype, &finding.Slot, &finding.Rule, &finding.Action, &finding.Field, &finding.Message, &finding.Timestamp)
+		if err != nil {
+			return findings, err
+		}
+
+		findings = append(findings, finding)
+	}
+
+	return findings, nil
+}
+
+func truncate(s string, length int) string {
+	if len(s) > length {
+		return s[:length]
+	}
+
+	return s
+}
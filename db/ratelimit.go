@@ -0,0 +1,44 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"context"
+)
+
+// TakeRateLimitToken refills the token bucket key at rate tokens per second up to burst and takes a token from it if there is one.
+// The assignments are evaluated in order, so allowed is computed from the bucket before tokens is updated.
+func TakeRateLimitToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	var allowed bool
+	var tokens float64
+	err := queryRow(ctx, "INSERT INTO rateLimits (id, tokens, rate, burst, allowed, updated) VALUES (?, ? - 1, ?, ?, 1, UTC_TIMESTAMP(6)) ON DUPLICATE KEY UPDATE allowed = LEAST(?, tokens + TIMESTAMPDIFF(MICROSECOND, updated, UTC_TIMESTAMP(6)) / 1000000 * ?) >= 1, tokens = LEAST(?, tokens + TIMESTAMPDIFF(MICROSECOND, updated, UTC_TIMESTAMP(6)) / 1000000 * ?) - allowed, rate = ?, burst = ?, updated = UTC_TIMESTAMP(6) RETURNING allowed, tokens", key, burst, rate, burst, burst, rate, burst, rate, rate, burst).Scan(&allowed, &tokens)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return allowed, tokens, nil
+}
+
+func DeleteFullRateLimits(ctx context.Context) error {
+	_, err := exec(ctx, "DELETE FROM rateLimits WHERE tokens + TIMESTAMPDIFF(MICROSECOND, updated, UTC_TIMESTAMP(6)) / 1000000 * rate >= burst")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
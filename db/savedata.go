@@ -19,21 +19,25 @@ package db
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
+	"fmt"
 
 	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/metrics"
+	"github.com/pagefaultgames/rogueserver/tracing"
 )
 
-func TryAddDailyRunCompletion(uuid []byte, seed string, mode int) (bool, error) {
+func TryAddDailyRunCompletion(ctx context.Context, uuid []byte, seed string, mode int) (bool, error) {
 	var count int
-	err := handle.QueryRow("SELECT COUNT(*) FROM dailyRunCompletions WHERE uuid = ? AND seed = ?", uuid, seed).Scan(&count)
+	err := queryRow(ctx, "SELECT COUNT(*) FROM dailyRunCompletions WHERE uuid = ? AND seed = ?", uuid, seed).Scan(&count)
 	if err != nil {
 		return false, err
 	} else if count > 0 {
 		return false, nil
 	}
 
-	_, err = handle.Exec("INSERT INTO dailyRunCompletions (uuid, seed, mode, timestamp) VALUES (?, ?, ?, UTC_TIMESTAMP())", uuid, seed, mode)
+	_, err = exec(ctx, "INSERT INTO dailyRunCompletions (uuid, seed, mode, timestamp) VALUES (?, ?, ?, UTC_TIMESTAMP())", uuid, seed, mode)
 	if err != nil {
 		return false, err
 	}
@@ -41,31 +45,42 @@ func TryAddDailyRunCompletion(uuid []byte, seed string, mode int) (bool, error)
 	return true, nil
 }
 
-func ReadSystemSaveData(uuid []byte) (defs.SystemSaveData, error) {
+func ReadSystemSaveData(ctx context.Context, uuid []byte) (defs.SystemSaveData, error) {
 	var system defs.SystemSaveData
 
 	var data []byte
-	err := handle.QueryRow("SELECT data FROM systemSaveData WHERE uuid = ?", uuid).Scan(&data)
+	err := queryRow(ctx, "SELECT data FROM systemSaveData WHERE uuid = ?", uuid).Scan(&data)
 	if err != nil {
 		return system, err
 	}
 
-	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&system)
+	err = decodeGob(ctx, data, &system)
 	if err != nil {
-		return system, err
+		// stored before the payload was typed
+		var untyped untypedSystemSaveData
+		if decodeGob(ctx, data, &untyped) != nil {
+			return system, err
+		}
+
+		system = defs.SystemSaveData{}
+		err = convertUntyped(untyped, &system)
+		if err != nil {
+			return system, fmt.Errorf("failed to convert system save data: %w", err)
+		}
 	}
 
 	return system, nil
 }
 
-func StoreSystemSaveData(uuid []byte, data defs.SystemSaveData) error {
-	var buf bytes.Buffer
-	err := gob.NewEncoder(&buf).Encode(data)
+func StoreSystemSaveData(ctx context.Context, uuid []byte, data defs.SystemSaveData) error {
+	buf, err := encodeGob(ctx, data)
 	if err != nil {
 		return err
 	}
 
-	_, err = handle.Exec("INSERT INTO systemSaveData (uuid, data, timestamp) VALUES (?, ?, UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE data = ?, timestamp = UTC_TIMESTAMP()", uuid, buf.Bytes(), buf.Bytes())
+	metrics.SaveDataSize.WithLabelValues("system").Observe(float64(len(buf)))
+
+	_, err = exec(ctx, "INSERT INTO systemSaveData (uuid, data, timestamp) VALUES (?, ?, UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE data = ?, timestamp = UTC_TIMESTAMP()", uuid, buf, buf)
 	if err != nil {
 		return err
 	}
@@ -73,8 +88,8 @@ func StoreSystemSaveData(uuid []byte, data defs.SystemSaveData) error {
 	return nil
 }
 
-func DeleteSystemSaveData(uuid []byte) error {
-	_, err := handle.Exec("DELETE FROM systemSaveData WHERE uuid = ?", uuid)
+func DeleteSystemSaveData(ctx context.Context, uuid []byte) error {
+	_, err := exec(ctx, "DELETE FROM systemSaveData WHERE uuid = ?", uuid)
 	if err != nil {
 		return err
 	}
@@ -82,26 +97,36 @@ func DeleteSystemSaveData(uuid []byte) error {
 	return nil
 }
 
-func ReadSessionSaveData(uuid []byte, slot int) (defs.SessionSaveData, error) {
+func ReadSessionSaveData(ctx context.Context, uuid []byte, slot int) (defs.SessionSaveData, error) {
 	var session defs.SessionSaveData
 
 	var data []byte
-	err := handle.QueryRow("SELECT data FROM sessionSaveData WHERE uuid = ? AND slot = ?", uuid, slot).Scan(&data)
+	err := queryRow(ctx, "SELECT data FROM sessionSaveData WHERE uuid = ? AND slot = ?", uuid, slot).Scan(&data)
 	if err != nil {
 		return session, err
 	}
 
-	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&session)
+	err = decodeGob(ctx, data, &session)
 	if err != nil {
-		return session, err
+		// stored before the payload was typed
+		var untyped untypedSessionSaveData
+		if decodeGob(ctx, data, &untyped) != nil {
+			return session, err
+		}
+
+		session = defs.SessionSaveData{}
+		err = convertUntyped(untyped, &session)
+		if err != nil {
+			return session, fmt.Errorf("failed to convert session save data: %w", err)
+		}
 	}
 
 	return session, nil
 }
 
-func GetLatestSessionSaveDataSlot(uuid []byte) (int, error) {
+func GetLatestSessionSaveDataSlot(ctx context.Context, uuid []byte) (int, error) {
 	var slot int
-	err := handle.QueryRow("SELECT slot FROM sessionSaveData WHERE uuid = ? ORDER BY timestamp DESC, slot ASC LIMIT 1", uuid).Scan(&slot)
+	err := queryRow(ctx, "SELECT slot FROM sessionSaveData WHERE uuid = ? ORDER BY timestamp DESC, slot ASC LIMIT 1", uuid).Scan(&slot)
 	if err != nil {
 		return -1, err
 	}
@@ -109,14 +134,15 @@ func GetLatestSessionSaveDataSlot(uuid []byte) (int, error) {
 	return slot, nil
 }
 
-func StoreSessionSaveData(uuid []byte, data defs.SessionSaveData, slot int) error {
-	var buf bytes.Buffer
-	err := gob.NewEncoder(&buf).Encode(data)
+func StoreSessionSaveData(ctx context.Context, uuid []byte, data defs.SessionSaveData, slot int) error {
+	buf, err := encodeGob(ctx, data)
 	if err != nil {
 		return err
 	}
 
-	_, err = handle.Exec("INSERT INTO sessionSaveData (uuid, slot, data, timestamp) VALUES (?, ?, ?, UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE data = ?, timestamp = UTC_TIMESTAMP()", uuid, slot, buf.Bytes(), buf.Bytes())
+	metrics.SaveDataSize.WithLabelValues("session").Observe(float64(len(buf)))
+
+	_, err = exec(ctx, "INSERT INTO sessionSaveData (uuid, slot, data, timestamp) VALUES (?, ?, ?, UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE data = ?, timestamp = UTC_TIMESTAMP()", uuid, slot, buf, buf)
 	if err != nil {
 		return err
 	}
@@ -124,11 +150,30 @@ func StoreSessionSaveData(uuid []byte, data defs.SessionSaveData, slot int) erro
 	return nil
 }
 
-func DeleteSessionSaveData(uuid []byte, slot int) error {
-	_, err := handle.Exec("DELETE FROM sessionSaveData WHERE uuid = ? AND slot = ?", uuid, slot)
+func DeleteSessionSaveData(ctx context.Context, uuid []byte, slot int) error {
+	_, err := exec(ctx, "DELETE FROM sessionSaveData WHERE uuid = ? AND slot = ?", uuid, slot)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func encodeGob(ctx context.Context, v any) ([]byte, error) {
+	_, span := tracing.Start(ctx, "gob encode")
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	tracing.End(span, err)
+
+	return buf.Bytes(), err
+}
+
+func decodeGob(ctx context.Context, data []byte, v any) error {
+	_, span := tracing.Start(ctx, "gob decode")
+
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	tracing.End(span, err)
+
+	return err
+}
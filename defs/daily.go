@@ -17,9 +17,170 @@
 
 package defs
 
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultDailyChallenge is the id of the original daily run, the challenge of requests that don't name one
+const DefaultDailyChallenge = "daily"
+
+// DailyChallenge is a daily run played with its own seed and leaderboard
+type DailyChallenge struct {
+	Id   string `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+
+	// GameMode is the game mode the challenge is played in
+	GameMode int `json:"gameMode" yaml:"gameMode"`
+
+	// Waves is the wave a run has to beat to complete the challenge
+	Waves int `json:"waves" yaml:"waves"`
+
+	// Rules are flags for the client to change how the challenge is played, e.g. "noshop"
+	Rules []string `json:"rules,omitempty" yaml:"rules"`
+}
+
+// DailySeedCommitment is a commitment to the seed of a day made before it started: the hex encoded SHA-256 hash of the seed as served
+type DailySeedCommitment struct {
+	Date       string `json:"date"`
+	Commitment string `json:"commitment"`
+
+	// SecretVersion is the version of the secret the seed was derived from
+	SecretVersion int `json:"secretVersion"`
+
+	// Seed is revealed once the day started
+	Seed string `json:"seed,omitempty"`
+}
+
+// DailyRankingCategory is a leaderboard over the daily runs of a period
+type DailyRankingCategory struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+
+	// Period is day, week (starting on sunday), month, season or all
+	Period string `json:"period"`
+
+	// Aggregate is how a player's runs in the period are scored: sum, best or average (over the days played)
+	Aggregate string `json:"aggregate"`
+}
+
 type DailyRanking struct {
 	Rank     int    `json:"rank"`
 	Username string `json:"username"`
 	Score    int    `json:"score"`
-	Wave     int    `json:"wave"`
+
+	// Wave is the highest wave reached in the runs counted
+	Wave int `json:"wave"`
+
+	// Cursor is passed back to continue the rankings after this one
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// RankingCursor is the position of a ranking: its score, the timestamp of its last counted run and its player's uuid
+type RankingCursor struct {
+	Score     int
+	Timestamp string
+	Uuid      []byte
+}
+
+func (c RankingCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(c.Score) + "|" + c.Timestamp + "|" + hex.EncodeToString(c.Uuid)))
+}
+
+func ParseRankingCursor(s string) (RankingCursor, error) {
+	var cursor RankingCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, fmt.Errorf("invalid cursor: %s", err)
+	}
+
+	parts := strings.Split(string(data), "|")
+	if len(parts) != 3 {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+
+	cursor.Score, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return cursor, fmt.Errorf("invalid cursor: %s", err)
+	}
+
+	cursor.Timestamp = parts[1]
+
+	cursor.Uuid, err = hex.DecodeString(parts[2])
+	if err != nil {
+		return cursor, fmt.Errorf("invalid cursor: %s", err)
+	}
+
+	return cursor, nil
+}
+
+// DailyRankingPosition is a player's ranking with the rankings right above and below it
+type DailyRankingPosition struct {
+	Ranking DailyRanking   `json:"ranking"`
+	Above   []DailyRanking `json:"above"`
+	Below   []DailyRanking `json:"below"`
+}
+
+// DailySeed is a past daily run in the seed archive
+type DailySeed struct {
+	Date         string `json:"date"`
+	Seed         string `json:"seed"`
+	Participants int    `json:"participants"`
+
+	// Winner is the top run of the day, nil if no run is ranked
+	Winner *DailyRanking `json:"winner"`
+}
+
+// RankedDailyRun is a daily run as leaderboards count it
+type RankedDailyRun struct {
+	Uuid      []byte
+	Username  string
+	Date      string
+	Challenge string
+	Score     int
+	Wave      int
+	Timestamp string
+
+	// Ranked is false for hidden runs and runs of banned accounts
+	Ranked bool
+}
+
+// DailyRunProgress is what session updates have shown of a daily run so far
+type DailyRunProgress struct {
+	Wave     int
+	Score    int
+	Money    int
+	PlayTime int
+	Updates  int
+
+	// Elapsed is the number of seconds since the first update
+	Elapsed int
+
+	// Flag is the first suspicious thing seen in an update, if any
+	Flag string
+}
+
+// HiddenDailyRun is a daily run kept out of rankings until a moderator reviews it
+type HiddenDailyRun struct {
+	Username  string `json:"username"`
+	Date      string `json:"date"`
+	Challenge string `json:"challenge"`
+	Score     int    `json:"score"`
+	Wave      int    `json:"wave"`
+	Reason    string `json:"reason"`
+}
+
+// DailyRunReview is a moderator's decision on whether a daily run stays hidden
+type DailyRunReview struct {
+	Username string `json:"username"`
+	Date     string `json:"date"`
+
+	// Challenge is the challenge the run was played in, the default one if empty
+	Challenge string `json:"challenge"`
+
+	Hidden bool `json:"hidden"`
 }
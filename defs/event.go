@@ -0,0 +1,58 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package defs
+
+import "time"
+
+// EventChallengePrefix followed by an event's id is the challenge its runs are recorded under
+const EventChallengePrefix = "event-"
+
+// Event is a run played from Start to End with its own seeds and leaderboard, whose top players are rewarded when it ends
+type Event struct {
+	Id    int       `json:"id"`
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// GameMode is the game mode the event is played in
+	GameMode int `json:"gameMode"`
+
+	// Waves is the wave a run has to beat to complete the event
+	Waves int `json:"waves"`
+
+	// Seeds are played one per day from the start of the event, the last one until it ends, only shown to moderators
+	Seeds []string `json:"seeds,omitempty"`
+
+	// Seed is the seed played now, only set while the event is running
+	Seed string `json:"seed,omitempty"`
+
+	// Rules are flags for the client to change how the event is played, e.g. "noshop"
+	Rules []string `json:"rules,omitempty"`
+
+	Rewards []EventReward `json:"rewards"`
+
+	// Rewarded is set once the rewards were delivered
+	Rewarded bool `json:"rewarded"`
+}
+
+// EventReward is a number of vouchers of a type given to every player ranked Rank or better when an event ends, every participant if Rank is 0
+type EventReward struct {
+	Rank        int `json:"rank"`
+	VoucherType int `json:"voucherType"`
+	Count       int `json:"count"`
+}
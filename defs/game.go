@@ -21,3 +21,7 @@ type TitleStats struct {
 	PlayerCount int `json:"playerCount"`
 	BattleCount int `json:"battleCount"`
 }
+
+type ClassicSessionCount struct {
+	ClassicSessionCount int `json:"classicSessionCount"`
+}
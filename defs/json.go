@@ -0,0 +1,176 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package defs
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+	Save data comes from clients that may be newer than the server, so its types keep the fields they
+	don't know about in Extra and write them back out unchanged. Known fields are decoded strictly:
+	a value of the wrong type is an error rather than being dropped.
+*/
+
+// fieldIndexes caches the JSON names of struct fields by type
+var fieldIndexes sync.Map
+
+func jsonFields(t reflect.Type) map[string][]int {
+	if fields, ok := fieldIndexes.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+
+	fields := make(map[string][]int)
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fields[name] = field.Index
+	}
+
+	fieldIndexes.Store(t, fields)
+
+	return fields
+}
+
+// unmarshalKnown decodes the fields of the struct v points to and collects the rest in extra
+func unmarshalKnown(data []byte, v any, extra *map[string]json.RawMessage) error {
+	var values map[string]json.RawMessage
+	err := json.Unmarshal(data, &values)
+	if err != nil {
+		return err
+	}
+
+	target := reflect.ValueOf(v).Elem()
+	fields := jsonFields(target.Type())
+
+	*extra = nil
+	for name, value := range values {
+		index, ok := fields[name]
+		if !ok {
+			if *extra == nil {
+				*extra = make(map[string]json.RawMessage)
+			}
+
+			(*extra)[name] = value
+			continue
+		}
+
+		err = json.Unmarshal(value, target.FieldByIndex(index).Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// marshalKnown encodes v and adds the fields in extra it doesn't have itself
+func marshalKnown(v any, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var values map[string]json.RawMessage
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range extra {
+		if _, ok := values[name]; !ok {
+			values[name] = value
+		}
+	}
+
+	return json.Marshal(values)
+}
+
+// DexAttr is a bit field clients send as a number, or as a string once it no longer fits in one
+type DexAttr uint64
+
+func (a *DexAttr) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	text := string(data)
+	if strings.HasPrefix(text, `"`) {
+		err := json.Unmarshal(data, &text)
+		if err != nil {
+			return err
+		}
+	}
+
+	value, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid dex attribute %s", data)
+	}
+
+	*a = DexAttr(value)
+
+	return nil
+}
+
+// MarshalJSON always writes a string, numbers above 2^53 lose precision in JavaScript
+func (a DexAttr) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strconv.FormatUint(uint64(a), 10) + `"`), nil
+}
+
+// StarterMoveset is either one moveset, or a moveset per form index
+type StarterMoveset struct {
+	Moves []int
+	Forms map[int][]int
+}
+
+func (m *StarterMoveset) UnmarshalJSON(data []byte) error {
+	if strings.HasPrefix(string(data), "{") {
+		return json.Unmarshal(data, &m.Forms)
+	}
+
+	return json.Unmarshal(data, &m.Moves)
+}
+
+func (m StarterMoveset) MarshalJSON() ([]byte, error) {
+	if m.Forms != nil {
+		return json.Marshal(m.Forms)
+	}
+
+	return json.Marshal(m.Moves)
+}
+
+// IsZero reports whether no moveset is set
+func (m StarterMoveset) IsZero() bool {
+	return m.Moves == nil && m.Forms == nil
+}
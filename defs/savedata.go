@@ -17,7 +17,12 @@
 
 package defs
 
-const SessionSlotCount = 5
+import (
+	"encoding/json"
+)
+
+// SessionSlotCount is the number of session slots per account
+var SessionSlotCount = 5
 
 type SystemSaveData struct {
 	TrainerId          int                `json:"trainerId"`
@@ -35,38 +40,91 @@ type SystemSaveData struct {
 	Eggs               []EggData          `json:"eggs"`
 	GameVersion        string             `json:"gameVersion"`
 	Timestamp          int                `json:"timestamp"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type DexData map[int]DexEntry
 
 type DexEntry struct {
-	SeenAttr     interface{} `json:"seenAttr"`   // integer or string
-	CaughtAttr   interface{} `json:"caughtAttr"` // integer or string
-	NatureAttr   int         `json:"natureAttr"`
-	SeenCount    int         `json:"seenCount"`
-	CaughtCount  int         `json:"caughtCount"`
-	HatchedCount int         `json:"hatchedCount"`
-	Ivs          []int       `json:"ivs"`
+	SeenAttr     DexAttr `json:"seenAttr"`
+	CaughtAttr   DexAttr `json:"caughtAttr"`
+	NatureAttr   int     `json:"natureAttr"`
+	SeenCount    int     `json:"seenCount"`
+	CaughtCount  int     `json:"caughtCount"`
+	HatchedCount int     `json:"hatchedCount"`
+	Ivs          []int   `json:"ivs"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type StarterData map[int]StarterEntry
 
 type StarterEntry struct {
-	Moveset         interface{} `json:"moveset"`
-	EggMoves        int         `json:"eggMoves"`
-	CandyCount      int         `json:"candyCount"`
-	Friendship      int         `json:"friendship"`
-	AbilityAttr     int         `json:"abilityAttr"`
-	PassiveAttr     int         `json:"passiveAttr"`
-	ValueReduction  int         `json:"valueReduction"`
-	ClassicWinCount int         `json:"classicWinCount"`
+	Moveset         StarterMoveset `json:"moveset"`
+	EggMoves        int            `json:"eggMoves"`
+	CandyCount      int            `json:"candyCount"`
+	Friendship      int            `json:"friendship"`
+	AbilityAttr     int            `json:"abilityAttr"`
+	PassiveAttr     int            `json:"passiveAttr"`
+	ValueReduction  int            `json:"valueReduction"`
+	ClassicWinCount int            `json:"classicWinCount"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
-type StarterMoveData map[int]interface{}
+type StarterMoveData map[int]StarterMoveset
 
 type StarterEggMoveData map[int]int
 
-type GameStats interface{}
+type GameStats struct {
+	PlayTime                   int `json:"playTime"`
+	Battles                    int `json:"battles"`
+	ClassicSessionsPlayed      int `json:"classicSessionsPlayed"`
+	SessionsWon                int `json:"sessionsWon"`
+	RibbonsOwned               int `json:"ribbonsOwned"`
+	DailyRunSessionsPlayed     int `json:"dailyRunSessionsPlayed"`
+	DailyRunSessionsWon        int `json:"dailyRunSessionsWon"`
+	EndlessSessionsPlayed      int `json:"endlessSessionsPlayed"`
+	HighestEndlessWave         int `json:"highestEndlessWave"`
+	HighestLevel               int `json:"highestLevel"`
+	HighestMoney               int `json:"highestMoney"`
+	HighestDamage              int `json:"highestDamage"`
+	HighestHeal                int `json:"highestHeal"`
+	PokemonSeen                int `json:"pokemonSeen"`
+	PokemonDefeated            int `json:"pokemonDefeated"`
+	PokemonCaught              int `json:"pokemonCaught"`
+	PokemonHatched             int `json:"pokemonHatched"`
+	SubLegendaryPokemonSeen    int `json:"subLegendaryPokemonSeen"`
+	SubLegendaryPokemonCaught  int `json:"subLegendaryPokemonCaught"`
+	SubLegendaryPokemonHatched int `json:"subLegendaryPokemonHatched"`
+	LegendaryPokemonSeen       int `json:"legendaryPokemonSeen"`
+	LegendaryPokemonCaught     int `json:"legendaryPokemonCaught"`
+	LegendaryPokemonHatched    int `json:"legendaryPokemonHatched"`
+	MythicalPokemonSeen        int `json:"mythicalPokemonSeen"`
+	MythicalPokemonCaught      int `json:"mythicalPokemonCaught"`
+	MythicalPokemonHatched     int `json:"mythicalPokemonHatched"`
+	ShinyPokemonSeen           int `json:"shinyPokemonSeen"`
+	ShinyPokemonCaught         int `json:"shinyPokemonCaught"`
+	ShinyPokemonHatched        int `json:"shinyPokemonHatched"`
+	PokemonFused               int `json:"pokemonFused"`
+	TrainersDefeated           int `json:"trainersDefeated"`
+	EggsPulled                 int `json:"eggsPulled"`
+	RareEggsPulled             int `json:"rareEggsPulled"`
+	EpicEggsPulled             int `json:"epicEggsPulled"`
+	LegendaryEggsPulled        int `json:"legendaryEggsPulled"`
+	ManaphyEggsPulled          int `json:"manaphyEggsPulled"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+
+	// present holds the JSON names of the stats that were decoded, clients may send only some of them
+	present map[string]bool
+}
+
+// Has reports whether the stat with the JSON name was decoded
+func (g GameStats) Has(name string) bool {
+	return g.present[name]
+}
 
 type Unlocks map[int]bool
 
@@ -81,6 +139,8 @@ type EggData struct {
 	GachaType  GachaType `json:"gachaType"`
 	HatchWaves int       `json:"hatchWaves"`
 	Timestamp  int       `json:"timestamp"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type GachaType int
@@ -102,24 +162,122 @@ type SessionSaveData struct {
 	ReviveCount    int                      `json:"reviveCount"`
 	WaveIndex      int                      `json:"waveIndex"`
 	BattleType     BattleType               `json:"battleType"`
-	Trainer        TrainerData              `json:"trainer"`
+	Trainer        *TrainerData             `json:"trainer"`
 	GameVersion    string                   `json:"gameVersion"`
 	Timestamp      int                      `json:"timestamp"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type GameMode int
 
-type PokemonData interface{}
+type PokemonData struct {
+	Id                 int         `json:"id"`
+	Player             bool        `json:"player"`
+	Species            int         `json:"species"`
+	FormIndex          int         `json:"formIndex"`
+	AbilityIndex       int         `json:"abilityIndex"`
+	Passive            bool        `json:"passive"`
+	Shiny              bool        `json:"shiny"`
+	Variant            int         `json:"variant"`
+	Pokeball           int         `json:"pokeball"`
+	Level              int         `json:"level"`
+	Exp                int         `json:"exp"`
+	LevelExp           int         `json:"levelExp"`
+	Gender             int         `json:"gender"`
+	Hp                 int         `json:"hp"`
+	Stats              []int       `json:"stats"`
+	Ivs                []int       `json:"ivs"`
+	Nature             int         `json:"nature"`
+	NatureOverride     int         `json:"natureOverride"`
+	Moveset            Moveset     `json:"moveset"`
+	Status             *StatusData `json:"status"`
+	Friendship         int         `json:"friendship"`
+	MetLevel           int         `json:"metLevel"`
+	MetBiome           int         `json:"metBiome"`
+	Luck               int         `json:"luck"`
+	PauseEvolutions    bool        `json:"pauseEvolutions"`
+	Pokerus            bool        `json:"pokerus"`
+	FusionSpecies      int         `json:"fusionSpecies"`
+	FusionFormIndex    int         `json:"fusionFormIndex"`
+	FusionAbilityIndex int         `json:"fusionAbilityIndex"`
+	FusionShiny        bool        `json:"fusionShiny"`
+	FusionVariant      int         `json:"fusionVariant"`
+	FusionGender       int         `json:"fusionGender"`
+	FusionLuck         int         `json:"fusionLuck"`
+	Boss               bool        `json:"boss"`
+	BossSegments       int         `json:"bossSegments"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Moveset keeps empty move slots as nil, clients send them as null
+type Moveset []*PokemonMove
+
+type PokemonMove struct {
+	MoveId int `json:"moveId"`
+	PpUsed int `json:"ppUsed"`
+	PpUp   int `json:"ppUp"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type StatusData struct {
+	Effect    int `json:"effect"`
+	TurnCount int `json:"turnCount"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type PersistentModifierData struct {
+	ClassName  string `json:"className"`
+	Player     bool   `json:"player"`
+	StackCount int    `json:"stackCount"`
+	TypeId     string `json:"typeId"`
+
+	// arguments differ by modifier class
+	TypePregenArgs []json.RawMessage `json:"typePregenArgs"`
+	Args           []json.RawMessage `json:"args"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
 
-type PersistentModifierData interface{}
+type ArenaData struct {
+	Biome   int          `json:"biome"`
+	Weather *WeatherData `json:"weather"`
+	Terrain *TerrainData `json:"terrain"`
 
-type ArenaData interface{}
+	// tags differ by tag type
+	Tags []json.RawMessage `json:"tags"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type WeatherData struct {
+	WeatherType int `json:"weatherType"`
+	TurnsLeft   int `json:"turnsLeft"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type TerrainData struct {
+	TerrainType int `json:"terrainType"`
+	TurnsLeft   int `json:"turnsLeft"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
 
 type PokeballCounts map[string]int
 
 type BattleType int
 
-type TrainerData interface{}
+type TrainerData struct {
+	TrainerType        int `json:"trainerType"`
+	Variant            int `json:"variant"`
+	PartyTemplateIndex int `json:"partyTemplateIndex"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
 
 type SessionHistoryData struct {
 	Seed        string                   `json:"seed"`
@@ -134,6 +292,22 @@ type SessionHistoryData struct {
 	BattleType  BattleType               `json:"battleType"`
 	GameVersion string                   `json:"gameVersion"`
 	Timestamp   int                      `json:"timestamp"`
+
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type SessionHistoryResult int
+
+const (
+	SessionHistoryResultActive SessionHistoryResult = iota
+	SessionHistoryResultWin
+	SessionHistoryResultLoss
+	SessionHistoryResultAbandoned // deleted or replaced by a new run before it ended
+)
+
+// SessionHistoryEntry is a recorded run
+type SessionHistoryEntry struct {
+	Id       int                `json:"id"`
+	Username string             `json:"username"`
+	Run      SessionHistoryData `json:"run"`
+}
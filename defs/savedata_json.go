@@ -0,0 +1,192 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package defs
+
+import (
+	"encoding/json"
+)
+
+// JSON methods for the save data types that keep unknown fields, see json.go
+
+func (s *SystemSaveData) UnmarshalJSON(data []byte) error {
+	type known SystemSaveData
+	return unmarshalKnown(data, (*known)(s), &s.Extra)
+}
+
+func (s SystemSaveData) MarshalJSON() ([]byte, error) {
+	type known SystemSaveData
+	return marshalKnown(known(s), s.Extra)
+}
+
+func (d *DexEntry) UnmarshalJSON(data []byte) error {
+	type known DexEntry
+	return unmarshalKnown(data, (*known)(d), &d.Extra)
+}
+
+func (d DexEntry) MarshalJSON() ([]byte, error) {
+	type known DexEntry
+	return marshalKnown(known(d), d.Extra)
+}
+
+func (s *StarterEntry) UnmarshalJSON(data []byte) error {
+	type known StarterEntry
+	return unmarshalKnown(data, (*known)(s), &s.Extra)
+}
+
+func (s StarterEntry) MarshalJSON() ([]byte, error) {
+	type known StarterEntry
+	return marshalKnown(known(s), s.Extra)
+}
+
+func (g *GameStats) UnmarshalJSON(data []byte) error {
+	type known GameStats
+	err := unmarshalKnown(data, (*known)(g), &g.Extra)
+	if err != nil {
+		return err
+	}
+
+	var values map[string]json.RawMessage
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		return err
+	}
+
+	g.present = make(map[string]bool, len(values))
+	for name := range values {
+		if _, ok := g.Extra[name]; !ok {
+			g.present[name] = true
+		}
+	}
+
+	return nil
+}
+
+func (g GameStats) MarshalJSON() ([]byte, error) {
+	type known GameStats
+	return marshalKnown(known(g), g.Extra)
+}
+
+func (e *EggData) UnmarshalJSON(data []byte) error {
+	type known EggData
+	return unmarshalKnown(data, (*known)(e), &e.Extra)
+}
+
+func (e EggData) MarshalJSON() ([]byte, error) {
+	type known EggData
+	return marshalKnown(known(e), e.Extra)
+}
+
+func (s *SessionSaveData) UnmarshalJSON(data []byte) error {
+	type known SessionSaveData
+	return unmarshalKnown(data, (*known)(s), &s.Extra)
+}
+
+func (s SessionSaveData) MarshalJSON() ([]byte, error) {
+	type known SessionSaveData
+	return marshalKnown(known(s), s.Extra)
+}
+
+func (p *PokemonData) UnmarshalJSON(data []byte) error {
+	type known PokemonData
+	return unmarshalKnown(data, (*known)(p), &p.Extra)
+}
+
+func (p PokemonData) MarshalJSON() ([]byte, error) {
+	type known PokemonData
+	return marshalKnown(known(p), p.Extra)
+}
+
+func (p *PokemonMove) UnmarshalJSON(data []byte) error {
+	type known PokemonMove
+	return unmarshalKnown(data, (*known)(p), &p.Extra)
+}
+
+func (p PokemonMove) MarshalJSON() ([]byte, error) {
+	type known PokemonMove
+	return marshalKnown(known(p), p.Extra)
+}
+
+func (s *StatusData) UnmarshalJSON(data []byte) error {
+	type known StatusData
+	return unmarshalKnown(data, (*known)(s), &s.Extra)
+}
+
+func (s StatusData) MarshalJSON() ([]byte, error) {
+	type known StatusData
+	return marshalKnown(known(s), s.Extra)
+}
+
+func (p *PersistentModifierData) UnmarshalJSON(data []byte) error {
+	type known PersistentModifierData
+	return unmarshalKnown(data, (*known)(p), &p.Extra)
+}
+
+func (p PersistentModifierData) MarshalJSON() ([]byte, error) {
+	type known PersistentModifierData
+	return marshalKnown(known(p), p.Extra)
+}
+
+func (a *ArenaData) UnmarshalJSON(data []byte) error {
+	type known ArenaData
+	return unmarshalKnown(data, (*known)(a), &a.Extra)
+}
+
+func (a ArenaData) MarshalJSON() ([]byte, error) {
+	type known ArenaData
+	return marshalKnown(known(a), a.Extra)
+}
+
+func (w *WeatherData) UnmarshalJSON(data []byte) error {
+	type known WeatherData
+	return unmarshalKnown(data, (*known)(w), &w.Extra)
+}
+
+func (w WeatherData) MarshalJSON() ([]byte, error) {
+	type known WeatherData
+	return marshalKnown(known(w), w.Extra)
+}
+
+func (t *TerrainData) UnmarshalJSON(data []byte) error {
+	type known TerrainData
+	return unmarshalKnown(data, (*known)(t), &t.Extra)
+}
+
+func (t TerrainData) MarshalJSON() ([]byte, error) {
+	type known TerrainData
+	return marshalKnown(known(t), t.Extra)
+}
+
+func (t *TrainerData) UnmarshalJSON(data []byte) error {
+	type known TrainerData
+	return unmarshalKnown(data, (*known)(t), &t.Extra)
+}
+
+func (t TrainerData) MarshalJSON() ([]byte, error) {
+	type known TrainerData
+	return marshalKnown(known(t), t.Extra)
+}
+
+func (s *SessionHistoryData) UnmarshalJSON(data []byte) error {
+	type known SessionHistoryData
+	return unmarshalKnown(data, (*known)(s), &s.Extra)
+}
+
+func (s SessionHistoryData) MarshalJSON() ([]byte, error) {
+	type known SessionHistoryData
+	return marshalKnown(known(s), s.Extra)
+}
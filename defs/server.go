@@ -0,0 +1,40 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package defs
+
+type Readiness struct {
+	Ready bool `json:"ready"`
+
+	// Checks holds "ok" or the reason for failing by check name
+	Checks map[string]string `json:"checks"`
+}
+
+type VersionInfo struct {
+	Commit         string `json:"commit"`
+	SchemaVersion  int    `json:"schemaVersion"`
+	MinGameVersion string `json:"minGameVersion"`
+	MaxGameVersion string `json:"maxGameVersion,omitempty"`
+}
+
+// UnsupportedGameVersion is the body of responses to clients outside the supported game version range
+type UnsupportedGameVersion struct {
+	Error      string `json:"error"`
+	Version    string `json:"version"`
+	MinVersion string `json:"minVersion"`
+	MaxVersion string `json:"maxVersion,omitempty"`
+}
@@ -0,0 +1,221 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package gameversion gates clients by the game version they report in the X-Game-Version header
+// and in their saves. The supported range can be replaced at any time, e.g. when the config is reloaded.
+package gameversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pagefaultgames/rogueserver/defs"
+)
+
+const Header = "X-Game-Version"
+
+var (
+	current atomic.Pointer[Range]
+
+	// required rejects requests without a version header, otherwise only the versions of saves are checked for them
+	required atomic.Bool
+)
+
+func init() {
+	current.Store(&Range{Min: "1.0.4"})
+	required.Store(true)
+}
+
+// Range is the inclusive range of supported versions, an empty Max leaves it open ended
+type Range struct {
+	Min string
+	Max string
+}
+
+// Error is returned for versions outside of the supported range
+type Error struct {
+	Version string
+	Range   Range
+
+	// TooOld is set if the client has to update to a newer version
+	TooOld bool
+}
+
+func (e *Error) Error() string {
+	if e.TooOld {
+		return fmt.Sprintf("client version %s out of date, %s or newer required", e.Version, e.Range.Min)
+	}
+
+	return fmt.Sprintf("client version %q not supported", e.Version)
+}
+
+// Set replaces the supported range
+func Set(minVersion, maxVersion string) error {
+	if _, err := parse(minVersion); err != nil {
+		return fmt.Errorf("invalid minimum game version: %s", err)
+	}
+
+	if maxVersion != "" {
+		order, err := Compare(minVersion, maxVersion)
+		if err != nil {
+			return fmt.Errorf("invalid maximum game version: %s", err)
+		}
+
+		if order > 0 {
+			return fmt.Errorf("minimum game version %s is newer than maximum %s", minVersion, maxVersion)
+		}
+	}
+
+	current.Store(&Range{Min: minVersion, Max: maxVersion})
+
+	return nil
+}
+
+func Current() Range {
+	return *current.Load()
+}
+
+// SetRequired sets whether requests without a version header are rejected
+func SetRequired(value bool) {
+	required.Store(value)
+}
+
+// Required reports whether requests without a version header are rejected
+func Required() bool {
+	return required.Load()
+}
+
+// Check returns an *Error if version isn't in the supported range
+func Check(version string) error {
+	supported := Current()
+
+	order, err := Compare(version, supported.Min)
+	if err != nil {
+		return &Error{Version: version, Range: supported}
+	}
+
+	if order < 0 {
+		return &Error{Version: version, Range: supported, TooOld: true}
+	}
+
+	if supported.Max != "" {
+		if order, _ := Compare(version, supported.Max); order > 0 {
+			return &Error{Version: version, Range: supported}
+		}
+	}
+
+	return nil
+}
+
+// Handler rejects requests from clients reporting an unsupported version
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := r.Header.Get(Header)
+		if version == "" && !Required() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if version == "" {
+			WriteError(w, &Error{Range: Current()})
+			return
+		}
+
+		if err := Check(version); err != nil {
+			WriteError(w, err.(*Error))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WriteError tells the client which versions are supported, with 426 if it has to update
+func WriteError(w http.ResponseWriter, err *Error) {
+	response := defs.UnsupportedGameVersion{
+		Error:      "unsupported game version",
+		Version:    err.Version,
+		MinVersion: err.Range.Min,
+		MaxVersion: err.Range.Max,
+	}
+
+	code := http.StatusBadRequest
+	if err.TooOld {
+		response.Error = "update required"
+		code = http.StatusUpgradeRequired
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Compare orders dotted numeric versions, missing components count as 0 so 1.1 == 1.1.0
+func Compare(a, b string) (int, error) {
+	x, err := parse(a)
+	if err != nil {
+		return 0, err
+	}
+
+	y, err := parse(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < max(len(x), len(y)); i++ {
+		var m, n int
+		if i < len(x) {
+			m = x[i]
+		}
+		if i < len(y) {
+			n = y[i]
+		}
+
+		if m != n {
+			if m < n {
+				return -1, nil
+			}
+
+			return 1, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func parse(version string) ([]int, error) {
+	if version == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+
+	parts := strings.Split(version, ".")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+
+		numbers[i] = n
+	}
+
+	return numbers, nil
+}
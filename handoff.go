@@ -0,0 +1,221 @@
+//go:build !windows
+
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/*
+	Listeners are handed to the new process using the systemd socket activation convention,
+	so a socket activated service works the same way.
+	The first passed file descriptor is 3, names are given in LISTEN_FDNAMES.
+	The new process writes to the pipe in HANDOFF_READY_FD once it serves them, until then the old one keeps serving.
+*/
+
+const (
+	apiListenerName     = "api"
+	metricsListenerName = "metrics"
+
+	listenFdsStart = 3
+
+	readyFdEnv = "HANDOFF_READY_FD"
+)
+
+// handOffSignals start a new process that takes over the listeners before shutting down
+var handOffSignals = []os.Signal{syscall.SIGUSR2}
+
+// inheritListeners returns the listeners passed to this process, by name
+func inheritListeners() (map[string]net.Listener, error) {
+	listeners := make(map[string]net.Listener)
+
+	if os.Getenv("LISTEN_FDS") == "" {
+		return listeners, nil
+	}
+
+	// systemd sets LISTEN_PID to make sure the descriptors aren't meant for another process
+	if pid := os.Getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return listeners, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %s", err)
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	for i := 0; i < count; i++ {
+		name := apiListenerName
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(listenFdsStart+i), name)
+
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to inherit listener %s: %s", name, err)
+		}
+
+		listeners[name] = listener
+	}
+
+	return listeners, nil
+}
+
+// notifyReady tells the process that handed off its listeners that this one serves them
+func notifyReady() error {
+	fd := os.Getenv(readyFdEnv)
+	if fd == "" {
+		return nil
+	}
+
+	os.Unsetenv(readyFdEnv)
+
+	number, err := strconv.Atoi(fd)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", readyFdEnv, err)
+	}
+
+	file := os.NewFile(uintptr(number), "ready")
+	defer file.Close()
+
+	_, err = file.Write([]byte{1})
+
+	return err
+}
+
+// handOff starts a copy of this process with the same arguments that takes over the given listeners,
+// and waits up to timeout for it to serve them. The copy is stopped if it doesn't. metricsListener may be nil.
+func handOff(apiListener, metricsListener net.Listener, timeout time.Duration) (err error) {
+	var files []*os.File
+	var names []string
+
+	// unix sockets are kept for the new process, unless it fails to take them over
+	var unixListeners []*net.UnixListener
+	defer func() {
+		if err != nil {
+			for _, listener := range unixListeners {
+				listener.SetUnlinkOnClose(true)
+			}
+		}
+	}()
+
+	for name, listener := range map[string]net.Listener{apiListenerName: apiListener, metricsListenerName: metricsListener} {
+		if listener == nil {
+			continue
+		}
+
+		var file *os.File
+		var err error
+		switch listener := listener.(type) {
+		case *net.TCPListener:
+			file, err = listener.File()
+		case *net.UnixListener:
+			// the new process keeps using the socket file after we close our listener
+			listener.SetUnlinkOnClose(false)
+			unixListeners = append(unixListeners, listener)
+			file, err = listener.File()
+		default:
+			err = fmt.Errorf("unsupported listener type %T", listener)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get file of listener %s: %s", name, err)
+		}
+
+		defer file.Close()
+
+		files = append(files, file)
+		names = append(names, name)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var env []string
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, "LISTEN_") && !strings.HasPrefix(variable, readyFdEnv+"=") {
+			env = append(env, variable)
+		}
+	}
+
+	ready, notify, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create readiness pipe: %s", err)
+	}
+
+	defer ready.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(env, "LISTEN_FDS="+strconv.Itoa(len(files)), "LISTEN_FDNAMES="+strings.Join(names, ":"), readyFdEnv+"="+strconv.Itoa(listenFdsStart+len(files)))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, notify)
+
+	err = cmd.Start()
+
+	// only the new process holds the write end now, reading it ends if it exits
+	notify.Close()
+
+	if err != nil {
+		return err
+	}
+
+	notified := make(chan error, 1)
+	go func() {
+		_, err := ready.Read(make([]byte, 1))
+		notified <- err
+	}()
+
+	select {
+	case err = <-notified:
+		if errors.Is(err, io.EOF) {
+			err = fmt.Errorf("new process exited before serving")
+		}
+	case <-time.After(timeout):
+		err = fmt.Errorf("new process isn't serving after %s", timeout)
+	}
+
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+const (
+	apiListenerName     = "api"
+	metricsListenerName = "metrics"
+)
+
+// handing off listeners isn't supported on windows
+var handOffSignals []os.Signal
+
+func inheritListeners() (map[string]net.Listener, error) {
+	return make(map[string]net.Listener), nil
+}
+
+func handOff(apiListener, metricsListener net.Listener) error {
+	return fmt.Errorf("handing off listeners isn't supported on windows")
+}
@@ -0,0 +1,508 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package leaderboard
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/robfig/cron/v3"
+)
+
+/*
+	Leaderboards are the rankings of a period, precomputed from the database when first read and kept in Backend.
+	Recorded runs update the cached leaderboards of their period in place, and every ReconcileInterval the cached
+	leaderboards are rebuilt from the database to pick up changes that weren't recorded, e.g. bans. All-time
+	leaderboards read every run of their challenge, so they are only rebuilt every AllTimeReconcileInterval.
+*/
+
+var (
+	scheduler = cron.New(cron.WithLocation(time.UTC))
+
+	// Backend holds the leaderboards, a DatabaseStore shares them between instances and nil reads rankings from the database
+	Backend Store = NewMemoryStore()
+
+	// ReconcileInterval is how often cached leaderboards are rebuilt from the database
+	ReconcileInterval = 5 * time.Minute
+
+	// AllTimeReconcileInterval is how often cached leaderboards starting at AllTime are rebuilt, they read every run of their challenge
+	AllTimeReconcileInterval = time.Hour
+
+	// RetainEnded is how long the leaderboard of a past period is kept after it was built
+	RetainEnded = time.Hour
+
+	// building serializes building a leaderboard by key, so that concurrent misses query the database once
+	building sync.Map
+)
+
+// AllTime is the first date of the leaderboards over every run of a challenge
+const AllTime = "1000-01-01"
+
+// Key identifies a leaderboard: the runs of Challenge from the dates From to To, inclusive, scored by Aggregate (sum, best or average)
+type Key struct {
+	Challenge string
+	Aggregate string
+	From      string
+	To        string
+}
+
+func (k Key) String() string {
+	return k.Challenge + ":" + k.Aggregate + ":" + k.From + ":" + k.To
+}
+
+func parseKey(s string) (Key, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 {
+		return Key{}, fmt.Errorf("invalid leaderboard key %q", s)
+	}
+
+	return Key{Challenge: parts[0], Aggregate: parts[1], From: parts[2], To: parts[3]}, nil
+}
+
+// Version identifies the state of a leaderboard for conditional requests, the zero Version if it isn't cached
+type Version struct {
+	ETag     string
+	Modified time.Time
+}
+
+// Store keeps leaderboards by key
+type Store interface {
+	// View calls fn with the leaderboard under key, nil if it isn't stored
+	View(ctx context.Context, key Key, fn func(*Board)) error
+
+	// Update calls fn with the leaderboard under key, nil if it isn't stored, and stores what it returns, deleting the leaderboard if nil
+	Update(ctx context.Context, key Key, fn func(*Board) *Board) error
+
+	Keys(ctx context.Context) ([]Key, error)
+}
+
+func Init() error {
+	if Backend == nil {
+		return nil
+	}
+
+	_, err := scheduler.AddFunc(fmt.Sprintf("@every %s", ReconcileInterval), func() {
+		err := reconcile(context.Background())
+		if err != nil {
+			slog.Error("failed to reconcile leaderboards", "error", err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	scheduler.Start()
+
+	return nil
+}
+
+// Stop stops the reconcile scheduler, waiting for a running reconcile to finish
+func Stop() {
+	<-scheduler.Stop().Done()
+}
+
+// View calls fn with the leaderboard under key, building it from the database if it isn't stored
+func View(ctx context.Context, key Key, fn func(*Board)) error {
+	found := false
+	view := func(board *Board) {
+		if board != nil {
+			found = true
+			fn(board)
+		}
+	}
+
+	err := Backend.View(ctx, key, view)
+	if err != nil || found {
+		return err
+	}
+
+	lock, _ := building.LoadOrStore(key, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	// another request may have built it while this one waited
+	err = Backend.View(ctx, key, view)
+	if err != nil || found {
+		return err
+	}
+
+	board, err := build(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	err = Backend.Update(ctx, key, func(stored *Board) *Board {
+		if stored != nil {
+			return stored
+		}
+
+		return board
+	})
+	if err != nil {
+		return err
+	}
+
+	return Backend.View(ctx, key, view)
+}
+
+// Record updates the stored leaderboards under keys with run, leaderboards that aren't stored are left to be built when read
+func Record(ctx context.Context, keys []Key, run defs.RankedDailyRun) error {
+	for _, key := range keys {
+		if run.Challenge != key.Challenge || run.Date < key.From || run.Date > key.To {
+			continue
+		}
+
+		err := Backend.Update(ctx, key, func(board *Board) *Board {
+			if board != nil {
+				board.set(run)
+				board.Modified = time.Now().UTC()
+			}
+
+			return board
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Refresh rebuilds the stored leaderboards under keys from the database
+func Refresh(ctx context.Context, keys []Key) error {
+	for _, key := range keys {
+		err := rebuild(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconcile rebuilds the stored leaderboards from the database, dropping those of past periods once RetainEnded has passed
+func reconcile(ctx context.Context) error {
+	keys, err := Backend.Keys(ctx)
+	if err != nil {
+		return err
+	}
+
+	today := time.Now().UTC().Format(time.DateOnly)
+
+	for _, key := range keys {
+		if key.To < today {
+			err = Backend.Update(ctx, key, func(board *Board) *Board {
+				if board != nil && time.Since(board.Built) > RetainEnded {
+					return nil
+				}
+
+				return board
+			})
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// skip leaderboards that were just built, e.g. by another instance sharing them
+		interval := ReconcileInterval / 2
+		if key.From == AllTime {
+			interval = AllTimeReconcileInterval
+		}
+
+		var built time.Time
+		err = Backend.View(ctx, key, func(board *Board) {
+			if board != nil {
+				built = board.Built
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		if time.Since(built) < interval {
+			continue
+		}
+
+		err = rebuild(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebuild replaces the entries of the stored leaderboard under key with those built from the database, keeping its version if nothing changed
+func rebuild(ctx context.Context, key Key) error {
+	board, err := build(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return Backend.Update(ctx, key, func(stored *Board) *Board {
+		if stored != nil {
+			stored.replace(board)
+		}
+
+		return stored
+	})
+}
+
+func build(ctx context.Context, key Key) (*Board, error) {
+	if _, ok := aggregates[key.Aggregate]; !ok {
+		return nil, fmt.Errorf("unknown ranking aggregate %q", key.Aggregate)
+	}
+
+	runs, err := db.FetchRankedDailyRuns(ctx, key.Challenge, key.From, key.To)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	board := &Board{Key: key, Built: now, Modified: now}
+
+	entries := make(map[string]*Entry)
+	for _, run := range runs {
+		entry, ok := entries[string(run.Uuid)]
+		if !ok {
+			entry = &Entry{Uuid: run.Uuid, Username: run.Username, Runs: make(map[string]Run)}
+			entries[string(run.Uuid)] = entry
+			board.Entries = append(board.Entries, entry)
+		}
+
+		entry.Runs[run.Date] = Run{Score: run.Score, Wave: run.Wave, Timestamp: run.Timestamp}
+	}
+
+	board.rank()
+
+	return board, nil
+}
+
+// aggregates score a player's runs in a period, matching the database's ranking aggregates
+var aggregates = map[string]func(scores []int) int{
+	"sum": func(scores []int) int {
+		var sum int
+		for _, score := range scores {
+			sum += score
+		}
+
+		return sum
+	},
+	"best": func(scores []int) int {
+		return slices.Max(scores)
+	},
+	"average": func(scores []int) int {
+		var sum int
+		for _, score := range scores {
+			sum += score
+		}
+
+		return int(math.Round(float64(sum) / float64(len(scores))))
+	},
+}
+
+// Run is a daily run counted by a leaderboard
+type Run struct {
+	Score     int
+	Wave      int
+	Timestamp string
+}
+
+// Entry is a player on a leaderboard with their runs in its period by date
+type Entry struct {
+	Uuid     []byte
+	Username string
+	Runs     map[string]Run
+
+	score int
+	wave  int
+	last  string
+}
+
+// Board is a leaderboard, ranked like the database ranks it: by score, then by whose last counted run was recorded first, then by uuid
+type Board struct {
+	Key      Key
+	Entries  []*Entry
+	Built    time.Time
+	Modified time.Time
+
+	ranks map[string]int  // positions of entries by uuid
+	dirty map[string]bool // uuids of the entries set changed, if not nil
+}
+
+// set adds, replaces or removes run on the leaderboard and ranks it again
+func (b *Board) set(run defs.RankedDailyRun) {
+	index, ok := b.ranks[string(run.Uuid)]
+
+	var entry *Entry
+	if ok {
+		entry = b.Entries[index]
+	} else if run.Ranked {
+		entry = &Entry{Uuid: run.Uuid, Runs: make(map[string]Run)}
+		b.Entries = append(b.Entries, entry)
+	} else {
+		return
+	}
+
+	if b.dirty != nil {
+		b.dirty[string(run.Uuid)] = true
+	}
+
+	if run.Ranked {
+		entry.Username = run.Username
+		entry.Runs[run.Date] = Run{Score: run.Score, Wave: run.Wave, Timestamp: run.Timestamp}
+	} else {
+		delete(entry.Runs, run.Date)
+	}
+
+	if len(entry.Runs) == 0 {
+		b.Entries = slices.DeleteFunc(b.Entries, func(e *Entry) bool { return e == entry })
+	}
+
+	b.rank()
+}
+
+// replace takes the entries of built, a rebuild of the leaderboard, keeping the version if the rankings didn't change
+func (b *Board) replace(built *Board) {
+	if b.dirty != nil {
+		for _, entry := range built.Entries {
+			index, ok := b.ranks[string(entry.Uuid)]
+			if !ok || b.Entries[index].Username != entry.Username || !maps.Equal(b.Entries[index].Runs, entry.Runs) {
+				b.dirty[string(entry.Uuid)] = true
+			}
+		}
+
+		for _, entry := range b.Entries {
+			if _, ok := built.ranks[string(entry.Uuid)]; !ok {
+				b.dirty[string(entry.Uuid)] = true
+			}
+		}
+	}
+
+	if !slices.Equal(b.Rankings(1, b.Count()), built.Rankings(1, built.Count())) {
+		b.Modified = built.Modified
+	}
+
+	b.Entries, b.ranks, b.Built = built.Entries, built.ranks, built.Built
+}
+
+// rank scores every entry and sorts them
+func (b *Board) rank() {
+	aggregate := aggregates[b.Key.Aggregate]
+
+	for _, entry := range b.Entries {
+		scores := make([]int, 0, len(entry.Runs))
+		entry.wave, entry.last = 0, ""
+		for _, run := range entry.Runs {
+			scores = append(scores, run.Score)
+			entry.wave = max(entry.wave, run.Wave)
+			entry.last = max(entry.last, run.Timestamp)
+		}
+
+		entry.score = aggregate(scores)
+	}
+
+	slices.SortFunc(b.Entries, func(a, b *Entry) int {
+		return compare(a.cursor(), b.cursor())
+	})
+
+	b.ranks = make(map[string]int, len(b.Entries))
+	for i, entry := range b.Entries {
+		b.ranks[string(entry.Uuid)] = i
+	}
+}
+
+// Count returns the number of ranked players
+func (b *Board) Count() int {
+	return len(b.Entries)
+}
+
+// Rankings returns up to count rankings starting at rank
+func (b *Board) Rankings(rank, count int) []defs.DailyRanking {
+	rankings := []defs.DailyRanking{}
+	for i := max(rank-1, 0); i < len(b.Entries) && i < rank-1+count; i++ {
+		rankings = append(rankings, b.ranking(i))
+	}
+
+	return rankings
+}
+
+// Ranking returns the ranking of uuid, false if they aren't ranked
+func (b *Board) Ranking(uuid []byte) (defs.DailyRanking, bool) {
+	index, ok := b.ranks[string(uuid)]
+	if !ok {
+		return defs.DailyRanking{}, false
+	}
+
+	return b.ranking(index), true
+}
+
+// After returns up to count rankings after cursor
+func (b *Board) After(cursor defs.RankingCursor, count int) []defs.DailyRanking {
+	index, found := slices.BinarySearchFunc(b.Entries, cursor, func(entry *Entry, cursor defs.RankingCursor) int {
+		return compare(entry.cursor(), cursor)
+	})
+	if found {
+		index++
+	}
+
+	return b.Rankings(index+1, count)
+}
+
+func (b *Board) ranking(index int) defs.DailyRanking {
+	entry := b.Entries[index]
+	return defs.DailyRanking{Rank: index + 1, Username: entry.Username, Score: entry.score, Wave: entry.wave, Cursor: entry.cursor().String()}
+}
+
+func (e *Entry) cursor() defs.RankingCursor {
+	return defs.RankingCursor{Score: e.score, Timestamp: e.last, Uuid: e.Uuid}
+}
+
+// compare orders rankings by their cursors, best first
+func compare(a, b defs.RankingCursor) int {
+	switch {
+	case a.Score != b.Score:
+		return cmp.Compare(b.Score, a.Score)
+	case a.Timestamp != b.Timestamp:
+		return strings.Compare(a.Timestamp, b.Timestamp)
+	default:
+		return bytes.Compare(a.Uuid, b.Uuid)
+	}
+}
+
+// Version returns the version of the leaderboard for conditional requests
+func (b *Board) Version() Version {
+	hash := fnv.New32a()
+	hash.Write([]byte(b.Key.String()))
+
+	return Version{ETag: fmt.Sprintf("\"%x-%x\"", hash.Sum32(), b.Modified.UnixNano()), Modified: b.Modified}
+}
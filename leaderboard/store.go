@@ -0,0 +1,286 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package leaderboard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pagefaultgames/rogueserver/db"
+)
+
+// DatabaseSyncInterval is how long a DatabaseStore serves its copy of a leaderboard before checking the database for changes
+var DatabaseSyncInterval = time.Second
+
+// MemoryStore keeps leaderboards in this process, every instance builds its own from the database
+type MemoryStore struct {
+	mu     sync.RWMutex
+	boards map[Key]*Board
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{boards: make(map[Key]*Board)}
+}
+
+func (s *MemoryStore) View(ctx context.Context, key Key, fn func(*Board)) error {
+	// boards are ranked when they are built or updated, views only read them
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	fn(s.boards[key])
+
+	return nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, key Key, fn func(*Board) *Board) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	board := fn(s.boards[key])
+	if board == nil {
+		delete(s.boards, key)
+	} else {
+		s.boards[key] = board
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Keys(ctx context.Context) ([]Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]Key, 0, len(s.boards))
+	for key := range s.boards {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// DatabaseStore keeps leaderboards in the database so every instance shares them, and a copy of each in this process.
+// Updates are serialized across instances and only write the players they changed, views sync the copy with the
+// players changed since it was read at most every DatabaseSyncInterval.
+type DatabaseStore struct {
+	mu     sync.Mutex
+	boards map[Key]*syncedBoard
+}
+
+// syncedBoard is the copy of a leaderboard in the database, board is nil if it isn't stored
+type syncedBoard struct {
+	mu      sync.RWMutex
+	board   *Board
+	state   db.LeaderboardState
+	checked time.Time
+}
+
+func NewDatabaseStore() *DatabaseStore {
+	return &DatabaseStore{boards: make(map[Key]*syncedBoard)}
+}
+
+func (s *DatabaseStore) View(ctx context.Context, key Key, fn func(*Board)) error {
+	synced := s.synced(key)
+
+	synced.mu.RLock()
+	stale := time.Since(synced.checked) >= DatabaseSyncInterval
+	synced.mu.RUnlock()
+
+	if stale {
+		synced.mu.Lock()
+		err := synced.sync(ctx, key)
+		synced.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	synced.mu.RLock()
+	defer synced.mu.RUnlock()
+
+	fn(synced.board)
+
+	return nil
+}
+
+func (s *DatabaseStore) Update(ctx context.Context, key Key, fn func(*Board) *Board) error {
+	synced := s.synced(key)
+
+	synced.mu.Lock()
+	defer synced.mu.Unlock()
+
+	var board *Board
+	state, err := db.UpdateLeaderboard(ctx, key.String(), synced.state, func(stored *db.LeaderboardState, entries []db.LeaderboardEntry, full bool) (db.LeaderboardWrite, error) {
+		if stored == nil {
+			synced.board = nil
+		} else {
+			err := synced.apply(key, *stored, entries, full)
+			if err != nil {
+				return db.LeaderboardWrite{}, err
+			}
+		}
+
+		if synced.board != nil {
+			synced.board.dirty = make(map[string]bool)
+		}
+
+		board = fn(synced.board)
+		if board == nil {
+			return db.LeaderboardWrite{Delete: true}, nil
+		}
+
+		write := db.LeaderboardWrite{Replace: board != synced.board, Built: board.Built, Modified: board.Modified}
+		for _, entry := range board.Entries {
+			if write.Replace || board.dirty[string(entry.Uuid)] {
+				runs, err := json.Marshal(entry.Runs)
+				if err != nil {
+					return db.LeaderboardWrite{}, fmt.Errorf("failed to encode leaderboard entry: %s", err)
+				}
+
+				write.Entries = append(write.Entries, db.LeaderboardEntry{Uuid: entry.Uuid, Username: entry.Username, Runs: runs})
+			}
+		}
+
+		if !write.Replace {
+			// players the update removed
+			for uuid := range board.dirty {
+				if _, ok := board.ranks[uuid]; !ok {
+					write.Entries = append(write.Entries, db.LeaderboardEntry{Uuid: []byte(uuid), Runs: []byte("{}"), Deleted: true})
+				}
+			}
+		}
+
+		board.dirty = nil
+
+		return write, nil
+	})
+	if err != nil {
+		// the copy may have been changed by updates that weren't stored, read it again
+		synced.board, synced.state, synced.checked = nil, db.LeaderboardState{}, time.Time{}
+
+		return err
+	}
+
+	synced.board, synced.state, synced.checked = board, state, time.Now()
+
+	if board == nil {
+		s.mu.Lock()
+		delete(s.boards, key)
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (s *DatabaseStore) Keys(ctx context.Context) ([]Key, error) {
+	names, err := db.FetchLeaderboardKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]Key, 0, len(names))
+	for _, name := range names {
+		key, err := parseKey(name)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// synced returns the copy of the leaderboard under key
+func (s *DatabaseStore) synced(key Key) *syncedBoard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	synced, ok := s.boards[key]
+	if !ok {
+		synced = &syncedBoard{}
+		s.boards[key] = synced
+	}
+
+	return synced
+}
+
+// sync reads the players changed since the copy was read, unless another view just did
+func (b *syncedBoard) sync(ctx context.Context, key Key) error {
+	if time.Since(b.checked) < DatabaseSyncInterval {
+		return nil
+	}
+
+	state, entries, full, err := db.FetchLeaderboard(ctx, key.String(), b.state)
+	if errors.Is(err, sql.ErrNoRows) {
+		b.board, b.state, b.checked = nil, db.LeaderboardState{}, time.Now()
+		return nil
+	}
+
+	if err == nil {
+		err = b.apply(key, state, entries, full)
+	}
+
+	if err != nil {
+		b.board, b.state, b.checked = nil, db.LeaderboardState{}, time.Time{}
+		return err
+	}
+
+	b.checked = time.Now()
+
+	return nil
+}
+
+// apply updates the copy to state with the stored entries changed since it was read, replacing it if full
+func (b *syncedBoard) apply(key Key, state db.LeaderboardState, entries []db.LeaderboardEntry, full bool) error {
+	if full || b.board == nil {
+		b.board = &Board{Key: key}
+	}
+
+	removed := make(map[string]bool)
+	for _, stored := range entries {
+		if stored.Deleted {
+			removed[string(stored.Uuid)] = true
+			continue
+		}
+
+		entry := &Entry{Uuid: stored.Uuid, Username: stored.Username}
+		err := json.Unmarshal(stored.Runs, &entry.Runs)
+		if err != nil {
+			return fmt.Errorf("failed to decode leaderboard entry: %s", err)
+		}
+
+		if index, ok := b.board.ranks[string(entry.Uuid)]; ok {
+			b.board.Entries[index] = entry
+		} else {
+			b.board.Entries = append(b.board.Entries, entry)
+		}
+	}
+
+	b.board.Entries = slices.DeleteFunc(b.board.Entries, func(entry *Entry) bool { return removed[string(entry.Uuid)] })
+	b.board.Built, b.board.Modified = state.Built, state.Modified
+	b.board.rank()
+	b.state = state
+
+	return nil
+}
@@ -0,0 +1,153 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey struct{}
+
+// request is shared by everything handling a request, so the uuid can be filled in once it's known
+type request struct {
+	id   string
+	uuid string
+}
+
+// Init makes slog's default logger, and with it the log package, write JSON lines at or above level to w.
+// Records logged with a request's context carry its request id, uuid and trace id.
+func Init(w io.Writer, level slog.Level) {
+	slog.SetDefault(slog.New(contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})}))
+}
+
+// SetUUID records the authenticated account of the request ctx belongs to
+func SetUUID(ctx context.Context, uuid []byte) {
+	if req, ok := ctx.Value(contextKey{}).(*request); ok {
+		req.uuid = hex.EncodeToString(uuid)
+	}
+}
+
+// Handler assigns each request an id, or keeps the one the client sent, and logs a line once it's served
+func Handler(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		req := &request{id: r.Header.Get(RequestIDHeader)}
+		if !validRequestID(req.id) {
+			req.id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, req.id)
+
+		ctx := context.WithValue(r.Context(), contextKey{}, req)
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		slog.Log(ctx, level, "request",
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int("bytes", recorder.bytes),
+		)
+	})
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// validRequestID keeps client supplied ids from bloating or breaking log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+
+	return n, err
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if req, ok := ctx.Value(contextKey{}).(*request); ok {
+		record.AddAttrs(slog.String("requestId", req.id))
+
+		if req.uuid != "" {
+			record.AddAttrs(slog.String("uuid", req.uuid))
+		}
+	}
+
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("traceId", span.TraceID().String()))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,117 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "rogueserver"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route"})
+
+	ArgonWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "argon2_semaphore_wait_seconds",
+		Help:      "Time spent waiting for a free argon2 instance.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	})
+
+	SaveDataSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "savedata_size_bytes",
+		Help:      "Size of stored save data blobs by datatype.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 2, 12),
+	}, []string{"datatype"})
+
+	DailyClears = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "daily_clears_total",
+		Help:      "Number of cleared daily run sessions by whether the run was completed.",
+	}, []string{"completed"})
+
+	PlayerCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "players",
+		Help:      "Number of accounts active in the last 5 minutes.",
+	})
+
+	BattleCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "battles",
+		Help:      "Number of battles across all accounts.",
+	})
+
+	ClassicSessionCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "classic_sessions",
+		Help:      "Number of classic sessions played across all accounts.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requests,
+		requestDuration,
+		ArgonWait,
+		SaveDataSize,
+		DailyClears,
+		PlayerCount,
+		BattleCount,
+		ClassicSessionCount,
+	)
+}
+
+// RegisterDB exports the connection pool stats of handle
+func RegisterDB(handle *sql.DB, name string) {
+	registry.MustRegister(collectors.NewDBStatsCollector(handle, name))
+}
+
+// Handler serves the metrics in the prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Instrument wraps handler to count and time its requests under route
+func Instrument(route string, handler http.Handler) http.Handler {
+	labels := prometheus.Labels{"route": route}
+
+	return promhttp.InstrumentHandlerDuration(requestDuration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(requests.MustCurryWith(labels), handler))
+}
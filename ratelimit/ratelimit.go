@@ -0,0 +1,282 @@
+/*
+	Copyright (C) 2024  Pagefault Games
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Limit allows Count requests per Period on average, with bursts of up to Burst requests
+type Limit struct {
+	Count  int
+	Period time.Duration
+	Burst  int
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Count) / l.Period.Seconds()
+}
+
+// Result is the state of a bucket after taking a token from it
+type Result struct {
+	Allowed   bool
+	Remaining int
+
+	// Reset is how long until the bucket is full again, or until the next token if not Allowed
+	Reset time.Duration
+}
+
+// Store keeps token buckets by key
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+
+	// Cleanup forgets buckets that have been idle long enough to be full again
+	Cleanup(ctx context.Context) error
+}
+
+var (
+	scheduler = cron.New(cron.WithLocation(time.UTC))
+
+	// Backend holds the buckets, use a DatabaseStore to share limits between instances
+	Backend Store = NewMemoryStore()
+
+	// Limits by route pattern, "*" applies to routes without their own limit
+	Limits = make(map[string]Limit)
+
+	// ClientIPHeader is the header a reverse proxy puts the client's address in, the connection's address is used if empty
+	ClientIPHeader string
+
+	// TrustedProxies are the networks of the reverse proxies whose ClientIPHeader is honoured, it is ignored from any other peer
+	TrustedProxies []*net.IPNet
+)
+
+func Init() error {
+	_, err := scheduler.AddFunc("@every 10m", func() {
+		err := Backend.Cleanup(context.Background())
+		if err != nil {
+			slog.Error("failed to clean up rate limits", "error", err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	scheduler.Start()
+
+	return nil
+}
+
+// Stop stops the cleanup scheduler, waiting for a running cleanup to finish
+func Stop() {
+	<-scheduler.Stop().Done()
+}
+
+// ParseLimits parses comma separated limits in the form <route>=<count>/<period>[+<burst>],
+// e.g. "POST /account/register=5/1h,*=600/1m+100". Burst defaults to count.
+func ParseLimits(s string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		route, spec, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q: missing =", item)
+		}
+
+		spec, burst, hasBurst := strings.Cut(spec, "+")
+
+		count, period, ok := strings.Cut(spec, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q: missing /", item)
+		}
+
+		var limit Limit
+		var err error
+
+		limit.Count, err = strconv.Atoi(count)
+		if err != nil || limit.Count < 1 {
+			return nil, fmt.Errorf("invalid rate limit %q: invalid count", item)
+		}
+
+		limit.Period, err = time.ParseDuration(period)
+		if err != nil || limit.Period <= 0 {
+			return nil, fmt.Errorf("invalid rate limit %q: invalid period", item)
+		}
+
+		limit.Burst = limit.Count
+		if hasBurst {
+			limit.Burst, err = strconv.Atoi(burst)
+			if err != nil || limit.Burst < 1 {
+				return nil, fmt.Errorf("invalid rate limit %q: invalid burst", item)
+			}
+		}
+
+		limits[strings.TrimSpace(route)] = limit
+	}
+
+	return limits, nil
+}
+
+// Handler limits requests to route by client address and, if identify returns one, by account.
+// Responses carry RateLimit-* headers for the most restrictive of the two, rejected requests get a 429.
+func Handler(route string, identify func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := Limits[route]
+		if !ok {
+			limit, ok = Limits["*"]
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result, err := Backend.Take(r.Context(), "ip:"+route+":"+clientIP(r), limit)
+		if err != nil {
+			// don't turn a broken backend into an outage
+			slog.ErrorContext(r.Context(), "failed to check rate limit", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if result.Allowed {
+			if account := identify(r); account != "" {
+				accountResult, err := Backend.Take(r.Context(), "account:"+route+":"+account, limit)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "failed to check rate limit", "error", err)
+				} else if !accountResult.Allowed || accountResult.Remaining < result.Remaining {
+					result = accountResult
+				}
+			}
+		}
+
+		reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", reset)
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", reset)
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ParseTrustedProxies parses comma separated addresses or networks in CIDR notation, e.g. "10.0.0.0/8,192.168.1.10"
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", item)
+			}
+
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %s", item, err)
+		}
+
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+func trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range TrustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if ClientIPHeader == "" || !trusted(host) {
+		return host
+	}
+
+	// proxies append the address they saw to lists like X-Forwarded-For,
+	// the client is the last entry that isn't one of the trusted proxies
+	entries := strings.Split(r.Header.Get(ClientIPHeader), ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(entries[i])
+		if ip == "" {
+			break
+		}
+
+		if !trusted(ip) || i == 0 {
+			return ip
+		}
+	}
+
+	return host
+}
+
+// result derives the headers of a bucket from the tokens left in it
+func result(allowed bool, tokens float64, limit Limit) Result {
+	reset := (float64(limit.Burst) - tokens) / limit.rate()
+	if !allowed {
+		reset = (1 - tokens) / limit.rate()
+	}
+
+	return Result{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     time.Duration(reset * float64(time.Second)),
+	}
+}
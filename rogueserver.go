@@ -18,20 +18,42 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/gob"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/pagefaultgames/rogueserver/api"
+	"github.com/pagefaultgames/rogueserver/api/daily"
+	"github.com/pagefaultgames/rogueserver/api/savedata"
+	"github.com/pagefaultgames/rogueserver/config"
+	"github.com/pagefaultgames/rogueserver/cors"
 	"github.com/pagefaultgames/rogueserver/db"
+	"github.com/pagefaultgames/rogueserver/defs"
+	"github.com/pagefaultgames/rogueserver/gameversion"
+	"github.com/pagefaultgames/rogueserver/leaderboard"
+	"github.com/pagefaultgames/rogueserver/logging"
+	"github.com/pagefaultgames/rogueserver/metrics"
+	"github.com/pagefaultgames/rogueserver/ratelimit"
+	"github.com/pagefaultgames/rogueserver/tracing"
 )
 
 func main() {
 	// flag stuff
-	debug := flag.Bool("debug", false, "use debug mode")
+	debug := flag.Bool("debug", false, "deprecated, set corsorigins to * instead")
 
 	proto := flag.String("proto", "tcp", "protocol for api to use (tcp, unix)")
 	addr := flag.String("addr", "0.0.0.0:8001", "network address for api to listen on")
@@ -41,93 +63,391 @@ func main() {
 	dbproto := flag.String("dbproto", "tcp", "protocol for database connection")
 	dbaddr := flag.String("dbaddr", "localhost", "database address")
 	dbname := flag.String("dbname", "pokeroguedb", "database name")
+	dbreadtimeout := flag.Duration("dbreadtimeout", db.ReadTimeout, "deadline for a single database read, 0 to disable")
+	dbwritetimeout := flag.Duration("dbwritetimeout", db.WriteTimeout, "deadline for a single database write, 0 to disable")
 
 	tlscert := flag.String("tlscert", "", "tls certificate path")
-	tlskey := flag.String("tlskey", "",  "tls key path")
+	tlskey := flag.String("tlskey", "", "tls key path")
 
-	flag.Parse()
+	metricsproto := flag.String("metricsproto", "tcp", "protocol for metrics to use (tcp, unix)")
+	metricsaddr := flag.String("metricsaddr", "", "network address for metrics to listen on, disabled if empty")
+
+	shutdowntimeout := flag.Duration("shutdowntimeout", 30*time.Second, "how long to wait for in-flight requests when shutting down")
+	handofftimeout := flag.Duration("handofftimeout", time.Minute, "how long to wait for the new process to serve the listeners handed off to it before giving up and serving on")
+
+	traceexporter := flag.String("traceexporter", "none", "exporter for traces (none, otlp, stdout), otlp is configured with the OTEL_EXPORTER_OTLP_* environment variables")
+
+	corsorigins := flag.String("corsorigins", "https://pokerogue.net", "comma separated origins allowed to make cross origin requests, may contain a wildcard subdomain (https://*.example.com) or be *")
+	corscredentials := flag.Bool("corscredentials", false, "allow cross origin requests with credentials")
+	corsmaxage := flag.Duration("corsmaxage", 0, "how long browsers may cache preflight responses")
+
+	mingameversion := flag.String("mingameversion", gameversion.Current().Min, "oldest client version that is served, older clients are told to update, reloaded on SIGHUP")
+	maxgameversion := flag.String("maxgameversion", gameversion.Current().Max, "newest client version that is served, any newer version if empty, reloaded on SIGHUP")
+	requiregameversion := flag.Bool("requiregameversion", gameversion.Required(), "reject requests without an X-Game-Version header, reloaded on SIGHUP")
+	flag.IntVar(&defs.SessionSlotCount, "sessionslots", defs.SessionSlotCount, "number of session slots per account")
+	flag.IntVar(&savedata.ClassicWaveCount, "classicwaves", savedata.ClassicWaveCount, "wave a classic session has to beat to be completed")
+	flag.IntVar(&daily.Challenges[0].Waves, "dailywaves", daily.Challenges[0].Waves, "wave a daily run has to beat to be completed, set in the file instead with dailychallenges")
+	dailychallenges := flag.String("dailychallenges", "", "YAML or JSON file listing the daily challenges (id, name, gameMode, waves, rules), only the default \"daily\" challenge if empty")
+	dailysecret := flag.String("dailysecret", "", "base64 encoded secret of 16 to 64 bytes daily seeds are derived from, stored as a new version when it changes, the latest stored version if empty")
+	flag.DurationVar(&daily.SecretRotation, "dailysecretrotation", daily.SecretRotation, "how often a new random daily seed secret is stored if dailysecret is empty, 0 never rotates it")
+
+	ratelimits := flag.String("ratelimits", "", "comma separated rate limits per route in the form <route>=<count>/<period>[+<burst>], * for any other route, e.g. \"POST /account/register=5/1h,*=300/1m\"")
+	ratelimitbackend := flag.String("ratelimitbackend", "memory", "where rate limits are kept (memory, database), database shares them between instances")
+	flag.StringVar(&ratelimit.ClientIPHeader, "clientipheader", "", "header a reverse proxy puts the client address in, e.g. X-Forwarded-For, only honoured from trustedproxies")
+	trustedproxies := flag.String("trustedproxies", "", "comma separated addresses or CIDR networks of the reverse proxies clientipheader is honoured from")
+
+	leaderboardbackend := flag.String("leaderboardbackend", "memory", "where cached leaderboards are kept (memory, database, off), database shares them between instances, off reads rankings from the database")
+	flag.DurationVar(&leaderboard.ReconcileInterval, "leaderboardreconcile", leaderboard.ReconcileInterval, "how often cached leaderboards are rebuilt from the database")
+	flag.DurationVar(&leaderboard.AllTimeReconcileInterval, "leaderboardalltimereconcile", leaderboard.AllTimeReconcileInterval, "how often cached all-time leaderboards are rebuilt from the database, they read every run of their challenge")
+	flag.IntVar(&daily.MaxRankingLimit, "maxrankinglimit", daily.MaxRankingLimit, "most daily rankings a request can ask for at once")
+
+	flag.IntVar(&savedata.DailyWaveSlack, "dailywaveslack", savedata.DailyWaveSlack, "how many waves a daily clear may be ahead of the last session update of its run")
+	flag.Float64Var(&savedata.DailyMinUpdatesPerWave, "dailyminupdates", savedata.DailyMinUpdatesPerWave, "share of waves a daily run needs session updates for to be ranked without review")
+	flag.IntVar(&savedata.DailyMaxScorePerWave, "dailymaxscoreperwave", savedata.DailyMaxScorePerWave, "most score a daily run may gain per wave, 0 doesn't limit it")
+	flag.DurationVar(&savedata.DailyPlayTimeSlack, "dailyplaytimeslack", savedata.DailyPlayTimeSlack, "how far a daily run's play time may be ahead of the real time since its first session update")
+
+	savedatarules := flag.String("savedatarules", "", "comma separated overrides of save data validation rules in the form <rule>=<action>[/<limit>], actions are off, clamp, flag and reject, e.g. \"ivs=reject,candycount=clamp/999\"")
+
+	loglevel := flag.String("loglevel", "info", "lowest level of log lines to write (debug, info, warn, error)")
+
+	// settings can also come from a config file and the environment, see package config
+	err := config.Load(flag.CommandLine, os.Args[1:], "ROGUESERVER_")
+	if err != nil {
+		log.Fatalf("failed to load config: %s", err)
+	}
+
+	var level slog.Level
+	err = level.UnmarshalText([]byte(*loglevel))
+	if err != nil {
+		log.Fatalf("invalid config: loglevel: %s", err)
+	}
+
+	logging.Init(os.Stderr, level)
+
+	// debug only ever allowed any origin, it sets corsorigins unless that was set itself
+	if *debug {
+		corsset := false
+		flag.Visit(func(f *flag.Flag) {
+			corsset = corsset || f.Name == "corsorigins"
+		})
+
+		if corsset {
+			slog.Warn("debug is deprecated and ignored because corsorigins is set")
+		} else {
+			slog.Warn("debug is deprecated, set corsorigins to * instead")
+			flag.Set("corsorigins", "*")
+		}
+	}
+
+	if *dailychallenges != "" {
+		daily.Challenges, err = daily.LoadChallenges(*dailychallenges)
+		if err != nil {
+			log.Fatalf("invalid config: %s", err)
+		}
+	}
+
+	if *dailysecret != "" {
+		daily.Secret, err = base64.StdEncoding.DecodeString(*dailysecret)
+		if err != nil {
+			log.Fatalf("invalid config: dailysecret: %s", err)
+		}
+	}
+
+	err = validateConfig(*proto, *addr, *dbproto, *metricsproto, *tlscert, *tlskey, *corsorigins, *corscredentials)
+	if err != nil {
+		log.Fatalf("invalid config: %s", err)
+	}
+
+	err = gameversion.Set(*mingameversion, *maxgameversion)
+	if err != nil {
+		log.Fatalf("invalid config: %s", err)
+	}
+
+	gameversion.SetRequired(*requiregameversion)
+
+	err = savedata.ParseRules(*savedatarules)
+	if err != nil {
+		log.Fatalf("invalid config: %s", err)
+	}
+
+	ratelimit.Limits, err = ratelimit.ParseLimits(*ratelimits)
+	if err != nil {
+		log.Fatalf("invalid config: %s", err)
+	}
+
+	ratelimit.TrustedProxies, err = ratelimit.ParseTrustedProxies(*trustedproxies)
+	if err != nil {
+		log.Fatalf("invalid config: %s", err)
+	}
+
+	if ratelimit.ClientIPHeader != "" && len(ratelimit.TrustedProxies) == 0 {
+		slog.Warn("clientipheader is set without trustedproxies, it is ignored")
+	}
+
+	switch *ratelimitbackend {
+	case "memory":
+		ratelimit.Backend = ratelimit.NewMemoryStore()
+	case "database":
+		ratelimit.Backend = ratelimit.DatabaseStore{}
+	default:
+		log.Fatalf("invalid config: ratelimitbackend must be memory or database, got %q", *ratelimitbackend)
+	}
+
+	switch *leaderboardbackend {
+	case "memory":
+		leaderboard.Backend = leaderboard.NewMemoryStore()
+	case "database":
+		leaderboard.Backend = leaderboard.NewDatabaseStore()
+	case "off":
+		leaderboard.Backend = nil
+	default:
+		log.Fatalf("invalid config: leaderboardbackend must be memory, database or off, got %q", *leaderboardbackend)
+	}
 
 	// register gob types
 	gob.Register([]interface{}{})
 	gob.Register(map[string]interface{}{})
 
+	// set up tracing before anything that may record spans
+	shutdownTracing, err := tracing.Init(*traceexporter)
+	if err != nil {
+		log.Fatalf("failed to initialize tracing: %s", err)
+	}
+
 	// get database connection
-	err := db.Init(*dbuser, *dbpass, *dbproto, *dbaddr, *dbname)
+	db.ReadTimeout = *dbreadtimeout
+	db.WriteTimeout = *dbwritetimeout
+
+	err = db.Init(*dbuser, *dbpass, *dbproto, *dbaddr, *dbname)
 	if err != nil {
 		log.Fatalf("failed to initialize database: %s", err)
 	}
 
-	// create listener
-	listener, err := createListener(*proto, *addr)
+	// take over listeners from a previous process if it handed them off
+	inherited, err := inheritListeners()
 	if err != nil {
-		log.Fatalf("failed to create net listener: %s", err)
+		log.Fatalf("failed to inherit listeners: %s", err)
+	}
+
+	// create listener
+	listener, ok := inherited[apiListenerName]
+	if !ok {
+		listener, err = createListener(*proto, *addr)
+		if err != nil {
+			log.Fatalf("failed to create net listener: %s", err)
+		}
+	}
+
+	// serve metrics separately so they can be kept private
+	var metricsListener net.Listener
+	var metricsServer *http.Server
+	if *metricsaddr != "" {
+		metricsListener, ok = inherited[metricsListenerName]
+		if !ok {
+			metricsListener, err = createListener(*metricsproto, *metricsaddr)
+			if err != nil {
+				log.Fatalf("failed to create metrics net listener: %s", err)
+			}
+		}
+
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", metrics.Handler())
+
+		metricsServer = &http.Server{Handler: metricsMux}
+
+		go func() {
+			err := metricsServer.Serve(metricsListener)
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatalf("metrics server errored: %s", err)
+			}
+		}()
 	}
 
 	mux := http.NewServeMux()
 
 	// init api
-	api.Init(mux)
+	err = api.Init(mux)
+	if err != nil {
+		log.Fatalf("failed to initialize api: %s", err)
+	}
+
+	err = ratelimit.Init()
+	if err != nil {
+		log.Fatalf("failed to initialize rate limits: %s", err)
+	}
+
+	err = leaderboard.Init()
+	if err != nil {
+		log.Fatalf("failed to initialize leaderboards: %s", err)
+	}
 
 	// start web server
-	handler := prodHandler(mux)
-	if *debug {
-		handler = debugHandler(mux)
+	corsOptions := cors.Options{
+		AllowedOrigins:   strings.Split(*corsorigins, ","),
+		AllowCredentials: *corscredentials,
+		MaxAge:           *corsmaxage,
+	}
+	server := &http.Server{Handler: cors.Handler(corsOptions, mux)}
+
+	go func() {
+		var err error
+		if *tlscert == "" {
+			err = server.Serve(listener)
+		} else {
+			err = server.ServeTLS(listener, *tlscert, *tlskey)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("failed to create http server or server errored: %s", err)
+		}
+	}()
+
+	// the previous process shuts down once this one serves the listeners it handed off
+	err = notifyReady()
+	if err != nil {
+		log.Printf("failed to notify the previous process: %s", err)
 	}
 
-	if *tlscert == "" {
-		err = http.Serve(listener, handler)
-	} else {
-		err = http.ServeTLS(listener, handler, *tlscert, *tlskey)
+	// wait for a signal to stop, handing off the listeners first if asked to
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, handOffSignals...)...)
+
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			reloadGameVersions()
+			continue
+		}
+
+		if !slices.Contains(handOffSignals, sig) {
+			log.Printf("received %s, shutting down", sig)
+			break
+		}
+
+		err = handOff(listener, metricsListener, *handofftimeout)
+		if err != nil {
+			log.Printf("failed to hand off listeners: %s", err)
+			continue
+		}
+
+		log.Printf("handed off listeners, shutting down")
+		break
 	}
+
+	signal.Stop(signals)
+
+	// stop accepting connections and let in-flight requests finish
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdowntimeout)
+	defer cancel()
+
+	err = server.Shutdown(ctx)
 	if err != nil {
-		log.Fatalf("failed to create http server or server errored: %s", err)
+		log.Printf("failed to drain requests: %s", err)
+	}
+
+	if metricsServer != nil {
+		metricsServer.Shutdown(ctx)
+	}
+
+	api.Stop()
+	ratelimit.Stop()
+	leaderboard.Stop()
+
+	err = db.Close()
+	if err != nil {
+		log.Printf("failed to close database: %s", err)
+	}
+
+	err = shutdownTracing(ctx)
+	if err != nil {
+		log.Printf("failed to flush traces: %s", err)
 	}
 }
 
-func createListener(proto, addr string) (net.Listener, error) {
-	if proto == "unix" {
-		os.Remove(addr)
+// reloadGameVersions rereads the supported game version range and whether clients have to report one from the config file and environment
+func reloadGameVersions() {
+	values, err := config.Reread(flag.CommandLine, os.Args[1:], "ROGUESERVER_", "mingameversion", "maxgameversion", "requiregameversion")
+	if err != nil {
+		slog.Error("failed to reload config", "error", err)
+		return
 	}
 
-	listener, err := net.Listen(proto, addr)
+	required, err := strconv.ParseBool(values["requiregameversion"])
 	if err != nil {
-		return nil, err
+		slog.Error("failed to reload game versions", "error", err)
+		return
 	}
 
-	if proto == "unix" {
-		os.Chmod(addr, 0777)
+	err = gameversion.Set(values["mingameversion"], values["maxgameversion"])
+	if err != nil {
+		slog.Error("failed to reload game versions", "error", err)
+		return
 	}
 
-	return listener, nil
+	gameversion.SetRequired(required)
+
+	slog.Info("reloaded game versions", "min", values["mingameversion"], "max", values["maxgameversion"], "required", required)
 }
 
-func prodHandler(router *http.ServeMux) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
-		w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST")
-		w.Header().Set("Access-Control-Allow-Origin", "https://pokerogue.net")
+// validateConfig checks settings that can't be caught by flag parsing alone
+func validateConfig(proto, addr, dbproto, metricsproto, tlscert, tlskey, corsorigins string, corscredentials bool) error {
+	var errs []error
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+	for name, value := range map[string]string{"proto": proto, "dbproto": dbproto, "metricsproto": metricsproto} {
+		if value != "tcp" && value != "unix" {
+			errs = append(errs, fmt.Errorf("%s must be tcp or unix, got %q", name, value))
 		}
+	}
 
-		router.ServeHTTP(w, r)
-	})
-}
+	if addr == "" {
+		errs = append(errs, fmt.Errorf("addr must not be empty"))
+	}
 
-func debugHandler(router *http.ServeMux) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Headers", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "*")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+	if (tlscert == "") != (tlskey == "") {
+		errs = append(errs, fmt.Errorf("tlscert and tlskey must be given together"))
+	}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+	for _, origin := range strings.Split(corsorigins, ",") {
+		if origin == "" || strings.Count(origin, "*") > 1 || (origin != "*" && !strings.Contains(origin, "://")) {
+			errs = append(errs, fmt.Errorf("invalid cors origin %q", origin))
 		}
+	}
 
-		router.ServeHTTP(w, r)
-	})
+	// any site could make requests with the user's credentials
+	if corscredentials && slices.Contains(strings.Split(corsorigins, ","), "*") {
+		errs = append(errs, fmt.Errorf("corscredentials can't be used with the cors origin *"))
+	}
+
+	if defs.SessionSlotCount < 1 || defs.SessionSlotCount > 127 {
+		errs = append(errs, fmt.Errorf("sessionslots must be between 1 and 127, got %d", defs.SessionSlotCount))
+	}
+
+	if savedata.ClassicWaveCount < 1 || daily.DefaultChallenge().Waves < 1 {
+		errs = append(errs, fmt.Errorf("classicwaves and dailywaves must be positive"))
+	}
+
+	if daily.Secret != nil && (len(daily.Secret) < 16 || len(daily.Secret) > 64) {
+		errs = append(errs, fmt.Errorf("dailysecret must be 16 to 64 bytes, got %d", len(daily.Secret)))
+	}
+
+	if daily.Secret != nil && daily.SecretRotation > 0 {
+		errs = append(errs, fmt.Errorf("dailysecretrotation can't be used with dailysecret"))
+	}
+
+	return errors.Join(errs...)
 }
 
+func createListener(proto, addr string) (net.Listener, error) {
+	if proto == "unix" {
+		os.Remove(addr)
+	}
+
+	listener, err := net.Listen(proto, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if proto == "unix" {
+		os.Chmod(addr, 0777)
+	}
+
+	return listener, nil
+}